@@ -8,39 +8,58 @@ import (
 )
 
 // Run is the high level function which will take a list of services and
-// a genesis and both initialize and run all services in the order they
-// are provided. If there is an error during startup, then the new
-// directory will be deleted. Cancelling the context will gracefully
+// a genesis and both initialize and run all services in the order of
+// their dependencies. If there is an error during startup, then the
+// network is rolled back. Cancelling the context will gracefully
 // shutdown all services
 func Run(ctx context.Context, dir string, genesis *genesis.Genesis, services ...Service) (err error) {
 	manager, err := New(dir, genesis, services...)
 	if err != nil {
 		return err
 	}
+	return manager.Run(ctx)
+}
 
-	if err := manager.Setup(ctx); err != nil {
+// Run sets up and starts the services and then serves the control panel
+// until the context is cancelled, after which all services are stopped.
+// On an existing network, the services are resumed to the state they were
+// in when the network was last run.
+// It allows a Conductor to be configured before running it. If there is
+// an error during startup, then the network is rolled back: started
+// services are stopped and only what was created by this run is deleted.
+// The lock on the Apollo directory is released when Run returns.
+func (c *Conductor) Run(ctx context.Context) error {
+	defer func() {
+		if err := c.Close(); err != nil {
+			log.Printf("error releasing lock: %v", err)
+		}
+	}()
+	if err := c.Setup(ctx); err != nil {
+		c.rollback(err)
 		return err
 	}
 	defer func() {
-		if err := manager.Stop(context.Background()); err != nil {
+		if err := c.Stop(context.Background()); err != nil {
 			log.Printf("error stopping manager: %v", err)
 		}
 	}()
 
-	for _, service := range services {
-		if err := manager.StartService(ctx, service.Name()); err != nil {
-			// If there has been an error during startup, then
-			// delete the new directory
-			if cleanUpErr := manager.Cleanup(); cleanUpErr != nil {
-				log.Printf("error cleaning up: %v", cleanUpErr)
-			}
-			return err
-		}
+	if err := c.Resume(ctx); err != nil {
+		c.rollback(err)
+		return err
 	}
 
-	if err := manager.Serve(ctx); err != nil {
+	if err := c.Serve(ctx); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// rollback rolls back a failed startup. The context of Run may have been
+// cancelled, so services are stopped with a fresh one.
+func (c *Conductor) rollback(cause error) {
+	if err := c.Rollback(context.Background(), cause); err != nil {
+		log.Printf("error rolling back: %v", err)
+	}
+}
@@ -0,0 +1,394 @@
+// Package apollotest runs an in-process Apollo network for Go tests.
+//
+//	func TestRollup(t *testing.T) {
+//		net := apollotest.NewNetwork(t)
+//		client := net.LightClient()
+//		...
+//	}
+//
+// Each network uses its own temporary directory and random ports, so tests
+// can run networks in parallel. The network is stopped when the test ends.
+package apollotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/celestiaorg/apollo"
+	"github.com/celestiaorg/apollo/faucet"
+	"github.com/celestiaorg/apollo/genesis"
+	"github.com/celestiaorg/apollo/node/bridge"
+	"github.com/celestiaorg/apollo/node/consensus"
+	"github.com/celestiaorg/apollo/node/light"
+	"github.com/celestiaorg/celestia-app/app"
+	rpcclient "github.com/celestiaorg/celestia-node/api/rpc/client"
+	"github.com/celestiaorg/celestia-node/api/rpc/perms"
+	"github.com/celestiaorg/celestia-node/libs/authtoken"
+	"github.com/celestiaorg/celestia-node/libs/keystore"
+	"github.com/celestiaorg/celestia-node/nodebuilder"
+	"github.com/celestiaorg/celestia-node/nodebuilder/node"
+	"github.com/cosmos/cosmos-sdk/crypto/keyring"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cristalhq/jwt"
+	cometclient "github.com/tendermint/tendermint/rpc/client/http"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DefaultStartTimeout is the time a network has to set up and start all of
+// its services before the test fails.
+const DefaultStartTimeout = 3 * time.Minute
+
+type config struct {
+	genesis      *genesis.Genesis
+	consensus    *consensus.Config
+	faucet       *faucet.Config
+	bridge       *nodebuilder.Config
+	light        *nodebuilder.Config
+	withoutLight bool
+	services     []apollo.Service
+	startTimeout time.Duration
+	ports        *apollo.PortAllocator
+}
+
+func defaultConfig() *config {
+	return &config{
+		genesis:      genesis.NewDefaultGenesis(),
+		consensus:    consensus.DefaultConfig(),
+		faucet:       faucet.DefaultConfig(),
+		bridge:       nodebuilder.DefaultConfig(node.Bridge),
+		light:        light.DefaultConfig(),
+		startTimeout: DefaultStartTimeout,
+	}
+}
+
+// Option customizes the network created by NewNetwork.
+type Option func(*config)
+
+// WithGenesis sets the genesis of the network.
+func WithGenesis(gen *genesis.Genesis) Option {
+	return func(cfg *config) { cfg.genesis = gen }
+}
+
+// WithConsensusConfig sets the configuration of the consensus node. Its
+// ports are replaced with random ones.
+func WithConsensusConfig(consensusCfg *consensus.Config) Option {
+	return func(cfg *config) { cfg.consensus = consensusCfg }
+}
+
+// WithFaucetConfig sets the configuration of the faucet. Its port is
+// replaced with a random one.
+func WithFaucetConfig(faucetCfg *faucet.Config) Option {
+	return func(cfg *config) { cfg.faucet = faucetCfg }
+}
+
+// WithBridgeConfig sets the configuration of the bridge node. Its ports are
+// replaced with random ones.
+func WithBridgeConfig(bridgeCfg *nodebuilder.Config) Option {
+	return func(cfg *config) { cfg.bridge = bridgeCfg }
+}
+
+// WithLightConfig sets the configuration of the light node. Its ports are
+// replaced with random ones.
+func WithLightConfig(lightCfg *nodebuilder.Config) Option {
+	return func(cfg *config) { cfg.light = lightCfg }
+}
+
+// WithoutLightNode leaves out the light node, which makes the network
+// quicker to start for tests that only need a bridge node.
+func WithoutLightNode() Option {
+	return func(cfg *config) { cfg.withoutLight = true }
+}
+
+// WithServices adds services, such as a rollup, to the network.
+func WithServices(services ...apollo.Service) Option {
+	return func(cfg *config) { cfg.services = append(cfg.services, services...) }
+}
+
+// WithStartTimeout sets the time the network has to start.
+func WithStartTimeout(timeout time.Duration) Option {
+	return func(cfg *config) { cfg.startTimeout = timeout }
+}
+
+// WithPortAllocator sets the allocator used for the ports of all services,
+// for example to use fixed ports for debugging. By default, random ports
+// are used.
+func WithPortAllocator(ports *apollo.PortAllocator) Option {
+	return func(cfg *config) { cfg.ports = ports }
+}
+
+// Network is a running Apollo network.
+type Network struct {
+	t         testing.TB
+	conductor *apollo.Conductor
+	dir       string
+	hasLight  bool
+}
+
+// NewNetwork sets up and starts a network in a temporary directory and
+// waits until every service is ready. The test fails if the network can't
+// be started. The network is stopped when the test and all its subtests
+// have completed.
+func NewNetwork(t testing.TB, opts ...Option) *Network {
+	t.Helper()
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.ports == nil {
+		cfg.ports = apollo.NewPortAllocator().WithRandomPorts()
+	}
+
+	services := []apollo.Service{
+		consensus.New(cfg.consensus),
+		faucet.New(cfg.faucet),
+		bridge.New(cfg.bridge),
+	}
+	if !cfg.withoutLight {
+		services = append(services, light.New(cfg.light))
+	}
+	services = append(services, cfg.services...)
+
+	dir := t.TempDir()
+	conductor, err := apollo.New(dir, cfg.genesis, services...)
+	if err != nil {
+		t.Fatalf("creating network: %v", err)
+	}
+	serverCfg := apollo.DefaultServerConfig()
+	serverCfg.ListenAddress = "127.0.0.1:0"
+	conductor.WithPortAllocator(cfg.ports).WithServerConfig(serverCfg)
+
+	n := &Network{
+		t:         t,
+		conductor: conductor,
+		dir:       dir,
+		hasLight:  !cfg.withoutLight,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var served chan error
+	t.Cleanup(func() {
+		cancel()
+		if err := conductor.Stop(context.Background()); err != nil {
+			t.Errorf("stopping network: %v", err)
+		}
+		if err := conductor.Close(); err != nil {
+			t.Errorf("closing network: %v", err)
+		}
+		if served == nil {
+			return
+		}
+		if err := <-served; err != nil && !errors.Is(err, context.Canceled) {
+			t.Errorf("serving control panel: %v", err)
+		}
+	})
+
+	startCtx, cancelStart := context.WithTimeout(ctx, cfg.startTimeout)
+	defer cancelStart()
+	if err := conductor.Setup(startCtx); err != nil {
+		t.Fatalf("setting up network: %v", err)
+	}
+	if err := conductor.Start(startCtx); err != nil {
+		t.Fatalf("starting network: %v", err)
+	}
+
+	served = make(chan error, 1)
+	go func() { served <- conductor.Serve(ctx) }()
+	return n
+}
+
+// Conductor returns the conductor managing the services of the network.
+func (n *Network) Conductor() *apollo.Conductor {
+	return n.conductor
+}
+
+// Dir returns the directory that the network's services use.
+func (n *Network) Dir() string {
+	return n.dir
+}
+
+// Endpoints returns the endpoints of all running services.
+func (n *Network) Endpoints() apollo.Endpoints {
+	return n.conductor.Endpoints()
+}
+
+// Endpoint returns a single endpoint, failing the test if it isn't active.
+func (n *Network) Endpoint(label string) apollo.Endpoint {
+	n.t.Helper()
+	endpoint, ok := n.conductor.Endpoints()[label]
+	if !ok {
+		n.t.Fatalf("endpoint %s is not active", label)
+	}
+	return endpoint
+}
+
+// CometRPC returns the address of the consensus node's comet RPC server.
+func (n *Network) CometRPC() string {
+	return n.Endpoint(consensus.RPCEndpointLabel).String()
+}
+
+// GRPC returns the address of the consensus node's gRPC server.
+func (n *Network) GRPC() string {
+	return n.Endpoint(consensus.GRPCEndpointLabel).HostPort()
+}
+
+// API returns the address of the consensus node's REST API.
+func (n *Network) API() string {
+	return n.Endpoint(consensus.APIEndpointLabel).String()
+}
+
+// BridgeRPC returns the address of the bridge node's RPC server.
+func (n *Network) BridgeRPC() string {
+	return n.Endpoint(bridge.RPCEndpointLabel).String()
+}
+
+// LightRPC returns the address of the light node's RPC server.
+func (n *Network) LightRPC() string {
+	return n.Endpoint(light.RPCEndpointLabel).String()
+}
+
+// FaucetAPI returns the address of the faucet's API.
+func (n *Network) FaucetAPI() string {
+	return n.Endpoint(faucet.FaucetAPILabel).String()
+}
+
+// PanelAddress returns the URL of the network's control panel.
+func (n *Network) PanelAddress() string {
+	n.t.Helper()
+	if !waitFor(func() bool { return n.conductor.PanelAddress() != "" }) {
+		n.t.Fatal("control panel is not being served")
+	}
+	return n.conductor.PanelAddress()
+}
+
+// CometClient returns a client of the consensus node's comet RPC.
+func (n *Network) CometClient() *cometclient.HTTP {
+	n.t.Helper()
+	client, err := cometclient.New(n.CometRPC(), "/websocket")
+	if err != nil {
+		n.t.Fatalf("creating comet RPC client: %v", err)
+	}
+	return client
+}
+
+// GRPCConn returns a connection to the consensus node's gRPC server. It is
+// closed when the test ends.
+func (n *Network) GRPCConn() *grpc.ClientConn {
+	n.t.Helper()
+	endpoint := n.Endpoint(consensus.GRPCEndpointLabel)
+	if ip := net.ParseIP(endpoint.Host); ip != nil && ip.IsUnspecified() {
+		endpoint.Host = "127.0.0.1"
+	}
+	conn, err := grpc.Dial(endpoint.HostPort(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		n.t.Fatalf("dialing gRPC server: %v", err)
+	}
+	n.t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// BridgeClient returns a client of the bridge node's RPC with admin
+// permissions. It is closed when the test ends.
+func (n *Network) BridgeClient() *rpcclient.Client {
+	n.t.Helper()
+	return n.nodeClient(bridge.BridgeServiceName, n.BridgeRPC())
+}
+
+// LightClient returns a client of the light node's RPC with admin
+// permissions. It is closed when the test ends.
+func (n *Network) LightClient() *rpcclient.Client {
+	n.t.Helper()
+	if !n.hasLight {
+		n.t.Fatal("the network has no light node")
+	}
+	return n.nodeClient(light.LightServiceName, n.LightRPC())
+}
+
+func (n *Network) nodeClient(service, address string) *rpcclient.Client {
+	n.t.Helper()
+	client, err := rpcclient.NewClient(context.Background(), address, n.AuthToken(service))
+	if err != nil {
+		n.t.Fatalf("creating node RPC client for %s: %v", address, err)
+	}
+	n.t.Cleanup(client.Close)
+	return client
+}
+
+// AuthToken returns a token with admin permissions for the RPC of the bridge
+// or light node, signed with the node's own secret.
+func (n *Network) AuthToken(service string) string {
+	n.t.Helper()
+	ks, err := keystore.NewFSKeystore(filepath.Join(n.dir, service, "keys"), nil)
+	if err != nil {
+		n.t.Fatalf("opening keystore of %s: %v", service, err)
+	}
+	key, err := ks.Get(node.SecretName)
+	if err != nil {
+		n.t.Fatalf("reading JWT secret of %s: %v", service, err)
+	}
+	signer, err := jwt.NewHS256(key.Body)
+	if err != nil {
+		n.t.Fatalf("creating JWT signer for %s: %v", service, err)
+	}
+	token, err := authtoken.NewSignedJWT(signer, perms.AllPerms)
+	if err != nil {
+		n.t.Fatalf("signing auth token for %s: %v", service, err)
+	}
+	return token
+}
+
+// Keyring returns the keyring of a service. The consensus node's keyring
+// holds the validator's key, the faucet's keyring holds the funded faucet
+// account, and the bridge and light nodes' keyrings hold their node
+// accounts.
+func (n *Network) Keyring(service string) keyring.Keyring {
+	n.t.Helper()
+	dir := filepath.Join(n.dir, service)
+	switch service {
+	case bridge.BridgeServiceName, light.LightServiceName:
+		dir = filepath.Join(dir, "keys")
+	}
+	kr, err := keyring.New(app.Name, keyring.BackendTest, dir, nil, apollo.Codec().Codec)
+	if err != nil {
+		n.t.Fatalf("opening keyring of %s: %v", service, err)
+	}
+	return kr
+}
+
+// Fund requests funds from the faucet for the account.
+func (n *Network) Fund(ctx context.Context, address sdk.AccAddress) error {
+	url := fmt.Sprintf("%s/fund/%s", n.FaucetAPI(), address.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting funds: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("faucet returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func waitFor(condition func() bool) bool {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
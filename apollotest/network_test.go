@@ -0,0 +1,47 @@
+package apollotest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/celestiaorg/apollo/apollotest"
+	"github.com/celestiaorg/apollo/faucet"
+	"github.com/celestiaorg/celestia-app/pkg/appconsts"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	bank "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworksInParallel(t *testing.T) {
+	for _, name := range []string{"first", "second"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			net := apollotest.NewNetwork(t)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			status, err := net.CometClient().Status(ctx)
+			require.NoError(t, err)
+			require.Positive(t, status.SyncInfo.LatestBlockHeight)
+
+			head, err := net.LightClient().Header.LocalHead(ctx)
+			require.NoError(t, err)
+			require.Positive(t, head.Height())
+
+			// fund a new account from the faucet and check its balance
+			record, err := net.Keyring(faucet.FaucetServiceName).Key(faucet.FaucetServiceName)
+			require.NoError(t, err)
+			faucetAddress, err := record.GetAddress()
+			require.NoError(t, err)
+			account := sdk.AccAddress(faucetAddress.Bytes()[:10])
+			require.NoError(t, net.Fund(ctx, account))
+
+			bankClient := bank.NewQueryClient(net.GRPCConn())
+			require.Eventually(t, func() bool {
+				resp, err := bankClient.Balance(ctx, bank.NewQueryBalanceRequest(account, appconsts.BondDenom))
+				return err == nil && resp.Balance.IsPositive()
+			}, 30*time.Second, 500*time.Millisecond)
+		})
+	}
+}
@@ -1,26 +1,48 @@
 package cmd
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/celestiaorg/apollo"
 	"github.com/spf13/cobra"
 )
 
 func NewDownCmd() *cobra.Command {
+	var (
+		address  string
+		insecure bool
+	)
 	cmd := &cobra.Command{
 		Use:   "down",
 		Short: "Shuts down the Apollo network.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return ShutdownNode()
+			if address == "" {
+				dir, err := ApolloHome(cmd)
+				if err != nil {
+					return err
+				}
+				address, err = apollo.ReadPanelAddress(dir)
+				if err != nil {
+					return fmt.Errorf("%w. Is the network running? Use --address to set the control panel address", err)
+				}
+			}
+			return ShutdownNode(address, insecure)
 		},
 	}
 
+	cmd.Flags().StringVar(&address, "address", "", "URL of the control panel (defaults to the address of the running network)")
+	cmd.Flags().BoolVar(&insecure, "insecure", false, "skip verification of the control panel's TLS certificate")
+
 	return cmd
 }
 
-func ShutdownNode() error {
-	resp, err := http.Get("http://localhost:8080/shutdown/")
+// ShutdownNode stops all services of the network served by the control
+// panel at the given address.
+func ShutdownNode(address string, insecure bool) error {
+	resp, err := newPanelClient(insecure).Get(panelEndpoint(address, "/shutdown/"))
 	if err != nil {
 		return fmt.Errorf("failed to call shutdown endpoint: %w", err)
 	}
@@ -33,3 +55,24 @@ func ShutdownNode() error {
 	fmt.Println("apollo network shut down successfully")
 	return nil
 }
+
+// newPanelClient returns a client for the control panel.
+func newPanelClient(insecure bool) *http.Client {
+	if !insecure {
+		return http.DefaultClient
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+		},
+	}
+}
+
+// panelEndpoint returns the URL of an endpoint of the control panel at the
+// given address.
+func panelEndpoint(address, path string) string {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	return strings.TrimSuffix(address, "/") + path
+}
@@ -0,0 +1,286 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/celestiaorg/apollo"
+	"github.com/spf13/cobra"
+)
+
+const (
+	homeFlag    = "home"
+	profileFlag = "profile"
+
+	// DefaultProfile is the name of the profile that is used unless
+	// another one is selected with --profile.
+	DefaultProfile = "default"
+	// ProfilesDir is the directory within the Apollo home directory that
+	// holds the Apollo directories of the profiles other than the default
+	// one, which is kept next to it.
+	ProfilesDir = "profiles"
+	// ProfilesFile is the file within the Apollo home directory that
+	// records the control panel address and port offset of every profile.
+	ProfilesFile = "profiles.json"
+
+	// profilePortStep is how far apart the ports of profiles are moved
+	// when they are given their port offset.
+	profilePortStep = 100
+)
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Profile holds the settings that are kept for a profile so that its
+// network runs on the same ports every time and doesn't collide with the
+// networks of other profiles.
+type Profile struct {
+	// Address is the address the control panel listens on. If it isn't
+	// set, the control panel listens on the default address shifted by
+	// the port offset.
+	Address    string `json:"address,omitempty"`
+	PortOffset int    `json:"port_offset"`
+}
+
+// PanelAddress returns the address the control panel of the profile
+// listens on.
+func (p Profile) PanelAddress() (string, error) {
+	if p.Address != "" {
+		return p.Address, nil
+	}
+	return apollo.NewPortAllocator().WithOffset(p.PortOffset).Address(apollo.DefaultListenAddress)
+}
+
+// profileDir returns the Apollo directory of a profile within the Apollo
+// home directory.
+func profileDir(home, profile string) (string, error) {
+	if profile == "" || profile == DefaultProfile {
+		return filepath.Join(home, DefaultProfile), nil
+	}
+	if !profileName.MatchString(profile) {
+		return "", fmt.Errorf("invalid profile name %q: use letters, digits, '.', '_' and '-'", profile)
+	}
+	return filepath.Join(home, ProfilesDir, profile), nil
+}
+
+// readProfiles returns the settings of the profiles in the Apollo home
+// directory.
+func readProfiles(home string) (map[string]Profile, error) {
+	profiles := make(map[string]Profile)
+	data, err := os.ReadFile(filepath.Join(home, ProfilesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", ProfilesFile, err)
+	}
+	return profiles, nil
+}
+
+func writeProfiles(home string, profiles map[string]Profile) error {
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(home, os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(home, ProfilesFile), data, 0o644)
+}
+
+// loadProfile returns the settings of a profile. A profile that has none
+// yet is given the lowest port offset that no other profile uses, which is
+// saved for its next runs.
+func loadProfile(home, name string) (Profile, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	profiles, err := readProfiles(home)
+	if err != nil {
+		return Profile{}, err
+	}
+	if profile, ok := profiles[name]; ok {
+		return profile, nil
+	}
+
+	used := make(map[int]bool, len(profiles))
+	for _, profile := range profiles {
+		used[profile.PortOffset] = true
+	}
+	var profile Profile
+	for used[profile.PortOffset] {
+		profile.PortOffset += profilePortStep
+	}
+	profiles[name] = profile
+	return profile, writeProfiles(home, profiles)
+}
+
+// saveProfile records the settings of a profile.
+func saveProfile(home, name string, profile Profile) error {
+	if name == "" {
+		name = DefaultProfile
+	}
+	profiles, err := readProfiles(home)
+	if err != nil {
+		return err
+	}
+	profiles[name] = profile
+	return writeProfiles(home, profiles)
+}
+
+// isOldHome returns true if the Apollo home directory holds a network that
+// an older version of Apollo kept in it directly, before each profile had
+// its own directory.
+func isOldHome(home string) bool {
+	if _, err := os.Stat(filepath.Join(home, apollo.ConfigDir)); err != nil {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(home, DefaultProfile))
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// migrateHome moves a network that an older version of Apollo kept in the
+// home directory itself to the directory of the default profile. The home
+// directory is renamed into a temporary sibling that then takes its place,
+// so that the network is either moved as a whole or not at all.
+func migrateHome(home string) (err error) {
+	if !isOldHome(home) {
+		return nil
+	}
+	if address, err := apollo.ReadPanelAddress(home); err == nil {
+		return fmt.Errorf("the network in %s is running at %s. Stop it before it can be moved to the %s profile", home, address, DefaultProfile)
+	}
+	release, err := apollo.LockDir(home)
+	if err != nil {
+		return err
+	}
+	// the lock moves together with the network
+	defer func() { err = errors.Join(err, release()) }()
+
+	moving, err := os.MkdirTemp(filepath.Dir(home), filepath.Base(home)+"-")
+	if err != nil {
+		return err
+	}
+	moved := filepath.Join(moving, DefaultProfile)
+	if err := os.Rename(home, moved); err != nil {
+		return errors.Join(fmt.Errorf("moving the network in %s to the %s profile: %w", home, DefaultProfile, err), os.Remove(moving))
+	}
+	if err := os.Rename(moving, home); err != nil {
+		// put the network back where it was
+		return errors.Join(fmt.Errorf("moving the network in %s to the %s profile: %w", home, DefaultProfile, err), os.Rename(moved, home), os.Remove(moving))
+	}
+	fmt.Printf("moved the network in %s to the %s profile at %s\n", home, DefaultProfile, filepath.Join(home, DefaultProfile))
+	return nil
+}
+
+func NewProfilesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profiles",
+		Short: "Manages the networks of named profiles.",
+		Long: `Manages the networks of named profiles.
+
+Every profile has its own Apollo directory, control panel and ports, so
+that separate networks can be kept side by side. Select a profile with
+--profile in any command. The default profile is kept in the default
+directory of the Apollo home directory and the others in its profiles
+directory.`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the profiles and whether their network is running.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			home, err := homeDir(cmd)
+			if err != nil {
+				return err
+			}
+			settings, err := readProfiles(home)
+			if err != nil {
+				return err
+			}
+			var profiles []string
+			if isOldHome(home) {
+				fmt.Printf("%s\tnot moved to its own directory yet, run `apollo up` to move it\t%s\n", DefaultProfile, home)
+			}
+			if _, err := os.Stat(filepath.Join(home, DefaultProfile)); err == nil {
+				profiles = append(profiles, DefaultProfile)
+			}
+			entries, err := os.ReadDir(filepath.Join(home, ProfilesDir))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			for _, entry := range entries {
+				if entry.IsDir() && profileName.MatchString(entry.Name()) {
+					profiles = append(profiles, entry.Name())
+				}
+			}
+
+			for _, profile := range profiles {
+				dir, err := profileDir(home, profile)
+				if err != nil {
+					return err
+				}
+				status := "stopped"
+				if address, err := apollo.ReadPanelAddress(dir); err == nil {
+					status = "running at " + address
+				} else if s, ok := settings[profile]; ok {
+					if address, err := s.PanelAddress(); err == nil {
+						status += ", panel at " + address
+					}
+				}
+				fmt.Printf("%s\t%s\t%s\n", profile, status, dir)
+			}
+			return nil
+		},
+	})
+
+	var force bool
+	rm := &cobra.Command{
+		Use:   "rm <name>",
+		Short: "Removes a profile together with the state of its network.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			home, err := homeDir(cmd)
+			if err != nil {
+				return err
+			}
+			dir, err := profileDir(home, name)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(dir); err != nil {
+				return fmt.Errorf("profile %s does not exist: %w", name, err)
+			}
+			if address, err := apollo.ReadPanelAddress(dir); err == nil && !force {
+				return fmt.Errorf("the network of profile %s is running at %s. Stop it with `apollo down --profile %s` first or use --force", name, address, name)
+			}
+			if err := os.RemoveAll(dir); err != nil {
+				return fmt.Errorf("failed to remove profile %s: %w", name, err)
+			}
+			profiles, err := readProfiles(home)
+			if err != nil {
+				return err
+			}
+			if _, ok := profiles[name]; ok {
+				delete(profiles, name)
+				if err := writeProfiles(home, profiles); err != nil {
+					return err
+				}
+			}
+			fmt.Printf("removed profile %s\n", name)
+			return nil
+		},
+	}
+	rm.Flags().BoolVar(&force, "force", false, "remove the profile even if its network appears to be running")
+	cmd.AddCommand(rm)
+
+	return cmd
+}
@@ -11,9 +11,15 @@ func NewRootCmd() *cobra.Command {
 		Long:  `Apollo CLI is a tool to run and manage a local Celestia devnet.`,
 	}
 
+	cmd.PersistentFlags().String(homeFlag, "", "directory that Apollo keeps the state of its networks in (default $HOME/.apollo)")
+	cmd.PersistentFlags().String(profileFlag, "", "name of the network to use, each with its own directory and control panel (default \"default\")")
+
 	// Add subcommands
 	cmd.AddCommand(NewUpCmd())
 	cmd.AddCommand(NewDownCmd())
+	cmd.AddCommand(NewSnapshotCmd())
+	cmd.AddCommand(NewStatusCmd())
+	cmd.AddCommand(NewProfilesCmd())
 
 	return cmd
 }
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/celestiaorg/apollo"
+	"github.com/spf13/cobra"
+)
+
+func NewSnapshotCmd() *cobra.Command {
+	var (
+		address  string
+		insecure bool
+	)
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Saves and restores the state of the Apollo network.",
+		Long: `Saves and restores the state of the Apollo network.
+
+If the network is running, its services are stopped while the snapshot is
+saved or restored and started again afterwards. Otherwise the Apollo
+directory is archived or restored directly.`,
+	}
+	cmd.PersistentFlags().StringVar(&address, "address", "", "URL of the control panel (defaults to the address of the running network)")
+	cmd.PersistentFlags().BoolVar(&insecure, "insecure", false, "skip verification of the control panel's TLS certificate")
+
+	run := func(action, done string, offline func(dir, name string) (*apollo.SnapshotManifest, error)) func(*cobra.Command, []string) error {
+		return func(cmd *cobra.Command, args []string) error {
+			dir, err := ApolloHome(cmd)
+			if err != nil {
+				return err
+			}
+			panel, release, err := runningPanel(dir, address)
+			if err != nil {
+				return err
+			}
+			var manifest *apollo.SnapshotManifest
+			if panel == "" {
+				// the lock is held until the snapshot has been saved or
+				// restored
+				manifest, err = offline(dir, args[0])
+				err = errors.Join(err, release())
+			} else {
+				err = getPanelJSON(panel, insecure, fmt.Sprintf("/snapshot/%s/%s", action, args[0]), &manifest)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s snapshot %s of chain %s with services %s\n", done, manifest.Name, manifest.ChainID, strings.Join(manifest.Services, ", "))
+			return nil
+		}
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "save <name>",
+		Short: "Saves the state of the network in a snapshot.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  run("save", "saved", apollo.SaveSnapshot),
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "restore <name>",
+		Short: "Replaces the state of the network with that of a snapshot.",
+		Args:  cobra.ExactArgs(1),
+		RunE:  run("restore", "restored", apollo.RestoreSnapshot),
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "Lists the saved snapshots.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := ApolloHome(cmd)
+			if err != nil {
+				return err
+			}
+			manifests, err := apollo.ListSnapshots(dir)
+			if err != nil {
+				return err
+			}
+			for _, manifest := range manifests {
+				fmt.Printf("%s\t%s\t%s\t%s\n", manifest.Name, manifest.Created.Format("2006-01-02 15:04:05"), manifest.ChainID, strings.Join(manifest.Services, ","))
+			}
+			return nil
+		},
+	})
+	return cmd
+}
+
+// runningPanel returns the address of the control panel of the network at
+// dir if it is running. Otherwise it returns an empty address and a function
+// that releases the lock on the directory, which keeps a network from being
+// started on it in the meantime. The lock rather than the address file
+// decides whether the network is running, as the file is only written once
+// the network has started and is left behind if the process is killed.
+func runningPanel(dir, address string) (string, func() error, error) {
+	noop := func() error { return nil }
+	if address != "" {
+		return address, noop, nil
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return "", noop, nil
+	}
+	release, err := apollo.LockDir(dir)
+	if errors.Is(err, apollo.ErrInUse) {
+		address, readErr := apollo.ReadPanelAddress(dir)
+		if readErr != nil {
+			return "", nil, fmt.Errorf("the network at %s is %w but its control panel isn't up yet. Try again once the network has started", dir, apollo.ErrInUse)
+		}
+		return address, noop, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return "", release, nil
+}
+
+// getPanelJSON calls an endpoint of the control panel and decodes its JSON
+// response.
+func getPanelJSON(address string, insecure bool, path string, v any) error {
+	resp, err := newPanelClient(insecure).Get(panelEndpoint(address, path))
+	if err != nil {
+		return fmt.Errorf("failed to call control panel: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("control panel returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/celestiaorg/apollo"
+	"github.com/spf13/cobra"
+)
+
+func NewStatusCmd() *cobra.Command {
+	var (
+		address  string
+		insecure bool
+	)
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Shows the status of the services of the Apollo network.",
+		Long: `Shows the status of the services of the Apollo network.
+
+If the network is running, the status is read from its control panel.
+Otherwise the services that will be started by the next "apollo up" are
+shown together with the endpoints they last provided.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := ApolloHome(cmd)
+			if err != nil {
+				return err
+			}
+			panel, release, err := runningPanel(dir, address)
+			if err != nil {
+				return err
+			}
+			if err := release(); err != nil {
+				return err
+			}
+			if panel != "" {
+				var status map[string]apollo.Status
+				if err := getPanelJSON(panel, insecure, "/status", &status); err != nil {
+					return err
+				}
+				fmt.Printf("network at %s is running, control panel at %s\n", dir, panel)
+				for _, name := range sortedKeys(status) {
+					fmt.Printf("%s\t%s\t%s\n", name, serviceState(status[name]), formatEndpoints(status[name].ProvidesEndpoints))
+				}
+				return nil
+			}
+
+			state, err := apollo.ReadState(dir)
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("no network has been run at %s", dir)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("network at %s is not running\n", dir)
+			for _, name := range sortedKeys(state.Services) {
+				service := state.Services[name]
+				enabled := "disabled"
+				if service.Enabled {
+					enabled = "enabled"
+				}
+				fmt.Printf("%s\t%s\t%s\n", name, enabled, formatEndpoints(service.Endpoints))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&address, "address", "", "URL of the control panel (defaults to the address of the running network)")
+	cmd.Flags().BoolVar(&insecure, "insecure", false, "skip verification of the control panel's TLS certificate")
+
+	return cmd
+}
+
+func serviceState(status apollo.Status) string {
+	switch {
+	case status.Running:
+		return "running"
+	case status.Recovering:
+		return "recovering"
+	case status.Failed:
+		return "failed"
+	default:
+		return "stopped"
+	}
+}
+
+func formatEndpoints(endpoints apollo.Endpoints) string {
+	formatted := make([]string, 0, len(endpoints))
+	for _, name := range sortedKeys(endpoints) {
+		formatted = append(formatted, fmt.Sprintf("%s=%s", name, endpoints[name]))
+	}
+	return strings.Join(formatted, " ")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
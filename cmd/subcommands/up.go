@@ -2,32 +2,72 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 
 	"github.com/celestiaorg/apollo"
-	"github.com/celestiaorg/apollo/faucet"
-	"github.com/celestiaorg/apollo/genesis"
-	"github.com/celestiaorg/apollo/node/bridge"
-	"github.com/celestiaorg/apollo/node/consensus"
-	"github.com/celestiaorg/apollo/node/light"
+	"github.com/celestiaorg/apollo/config"
 	"github.com/spf13/cobra"
-
-	"github.com/celestiaorg/celestia-app/app"
-	"github.com/celestiaorg/celestia-app/test/util/testnode"
-	"github.com/celestiaorg/celestia-node/nodebuilder"
-	"github.com/celestiaorg/celestia-node/nodebuilder/node"
 )
 
 const ApolloDir = ".apollo"
 
 func NewUpCmd() *cobra.Command {
+	serverCfg := apollo.DefaultServerConfig()
+	timeouts := apollo.DefaultTimeouts()
+	var (
+		address     string
+		portOffset  int
+		randomPorts bool
+		configPath  string
+		services    []string
+	)
 	cmd := &cobra.Command{
 		Use:   "up",
 		Short: "Starts the Apollo network.",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			home, err := homeDir(cmd)
+			if err != nil {
+				return err
+			}
+			if err := migrateHome(home); err != nil {
+				return err
+			}
+			name, err := cmd.Flags().GetString(profileFlag)
+			if err != nil {
+				return err
+			}
+			dir, err := profileDir(home, name)
+			if err != nil {
+				return err
+			}
+			// the profile keeps its address and port offset unless they
+			// are changed
+			profile, err := loadProfile(home, name)
+			if err != nil {
+				return err
+			}
+			if cmd.Flags().Changed("address") {
+				profile.Address = address
+			}
+			if cmd.Flags().Changed("port-offset") {
+				profile.PortOffset = portOffset
+			}
+			if cmd.Flags().Changed("address") || cmd.Flags().Changed("port-offset") {
+				if err := saveProfile(home, name, profile); err != nil {
+					return err
+				}
+			}
+			// an address that was asked for isn't shifted by the offset
+			if profile.Address != "" {
+				serverCfg.ListenAddress = profile.Address
+				serverCfg.FixedPort = true
+			}
+
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
@@ -39,31 +79,101 @@ func NewUpCmd() *cobra.Command {
 				cancel()
 			}()
 
-			return Run(ctx)
+			network := config.Default()
+			if configPath != "" {
+				network, err = config.Load(configPath)
+				if err != nil {
+					return err
+				}
+			}
+			if len(services) > 0 {
+				network = network.WithServices(services...)
+			}
+
+			ports := apollo.NewPortAllocator().WithOffset(profile.PortOffset)
+			if randomPorts {
+				ports = ports.WithRandomPorts()
+			}
+			return Run(ctx, dir, network, serverCfg, ports, timeouts)
 		},
 	}
 
+	cmd.Flags().StringVar(&configPath, "config", "", "path to a TOML file defining the services and genesis of the network")
+	cmd.Flags().StringSliceVar(&services, "services", nil, fmt.Sprintf("services to run instead of those in the network definition (registered types: %s)", strings.Join(apollo.ServiceTypes(), ", ")))
+	cmd.Flags().StringVar(&address, "address", "", fmt.Sprintf("address the control panel listens on, which is kept for the profile and isn't shifted by the port offset (default %s shifted by the port offset)", apollo.DefaultListenAddress))
+	cmd.Flags().DurationVar(&serverCfg.ReadTimeout, "read-timeout", serverCfg.ReadTimeout, "maximum duration for reading a request to the control panel")
+	cmd.Flags().DurationVar(&serverCfg.WriteTimeout, "write-timeout", serverCfg.WriteTimeout, "maximum duration for writing a response from the control panel (0 for none)")
+	cmd.Flags().StringVar(&serverCfg.TLSCertFile, "tls-cert", "", "path to a TLS certificate to serve the control panel over HTTPS")
+	cmd.Flags().StringVar(&serverCfg.TLSKeyFile, "tls-key", "", "path to the private key of the TLS certificate")
+	cmd.Flags().IntVar(&portOffset, "port-offset", 0, "shift the ports of all services and the control panel by this amount, which is kept for the profile (default: assigned when the profile is created)")
+	cmd.Flags().BoolVar(&randomPorts, "random-ports", false, "use any free ports for all services and the control panel")
+	cmd.Flags().DurationVar(&timeouts.Setup, "setup-timeout", timeouts.Setup, "maximum duration for setting up each service (0 for none)")
+	cmd.Flags().DurationVar(&timeouts.Start, "start-timeout", timeouts.Start, "maximum duration for each service to start and become ready (0 for none)")
+	cmd.Flags().DurationVar(&timeouts.Stop, "stop-timeout", timeouts.Stop, "maximum duration for stopping each service (0 for none)")
+
 	return cmd
 }
 
-func Run(ctx context.Context) error {
-	homeDir, err := os.UserHomeDir()
+// Run runs the network in the Apollo directory dir until the context is
+// cancelled. Timeouts set for services in the network definition take
+// precedence over the given ones.
+func Run(ctx context.Context, dir string, network *config.Network, serverCfg apollo.ServerConfig, ports *apollo.PortAllocator, timeouts apollo.Timeouts) error {
+	gen, err := network.NewGenesis()
+	if err != nil {
+		return err
+	}
+	services, err := network.NewServices()
 	if err != nil {
 		return err
 	}
-	dir := filepath.Join(homeDir, ApolloDir)
 
-	consensusCfg := testnode.DefaultConfig().
-		WithTendermintConfig(app.DefaultConsensusConfig()).
-		WithAppConfig(app.DefaultAppConfig())
+	serviceTimeouts, err := network.Timeouts()
+	if err != nil {
+		return err
+	}
 
-	lightCfg := nodebuilder.DefaultConfig(node.Light)
-	lightCfg.RPC.SkipAuth = true
+	conductor, err := apollo.New(dir, gen, services...)
+	if err != nil {
+		return err
+	}
+	conductor.WithTimeouts(timeouts)
+	for name, timeouts := range serviceTimeouts {
+		conductor.WithServiceTimeouts(name, timeouts)
+	}
+	return conductor.WithServerConfig(serverCfg).WithPortAllocator(ports).Run(ctx)
+}
 
-	return apollo.Run(ctx, dir, genesis.NewDefaultGenesis(),
-		consensus.New(consensusCfg),
-		faucet.New(faucet.DefaultConfig()),
-		bridge.New(nodebuilder.DefaultConfig(node.Bridge)),
-		light.New(lightCfg),
-	)
+// ApolloHome returns the directory that Apollo keeps the state of the
+// network in, which is the directory of the profile set with --profile
+// within the Apollo home directory.
+func ApolloHome(cmd *cobra.Command) (string, error) {
+	home, err := homeDir(cmd)
+	if err != nil {
+		return "", err
+	}
+	profile, err := cmd.Flags().GetString(profileFlag)
+	if err != nil {
+		return "", err
+	}
+	if (profile == "" || profile == DefaultProfile) && isOldHome(home) {
+		return "", fmt.Errorf("the network in %s was run by an older version of Apollo. Run `apollo up` to move it to the %s profile", home, DefaultProfile)
+	}
+	return profileDir(home, profile)
+}
+
+// homeDir returns the Apollo home directory, which is the directory set
+// with --home or $HOME/.apollo.
+func homeDir(cmd *cobra.Command) (string, error) {
+	home, err := cmd.Flags().GetString(homeFlag)
+	if err != nil {
+		return "", err
+	}
+	if home != "" {
+		return filepath.Abs(home)
+	}
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userHome, ApolloDir), nil
 }
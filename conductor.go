@@ -8,14 +8,19 @@ import (
 	"fmt"
 	"io/fs"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/celestiaorg/apollo/genesis"
 	"github.com/celestiaorg/celestia-node/nodebuilder/p2p"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
 	"github.com/tendermint/tendermint/types"
 )
 
@@ -23,50 +28,116 @@ import (
 var web embed.FS
 
 type Conductor struct {
-	lock            sync.Mutex
+	// opLock serializes operations that change the lifecycle of services:
+	// setting them up, starting, stopping and cleaning them up. These can
+	// take a long time, so services are called without holding the state
+	// lock. Both the Go API and the HTTP handlers go through the same
+	// exported methods and may be used at the same time.
+	opLock sync.Mutex
+	// lock protects the state of the conductor. It is only held briefly so
+	// that the status of services can be read while an operation is in
+	// progress.
+	lock            sync.RWMutex
 	services        map[string]Service
+	deps            map[string][]string
 	activeEndpoints Endpoints
 	activeServices  map[string]Service
+	layers          [][]string
 	startOrder      []string
 	rootDir         string
 	setup           bool
 	genesis         *genesis.Genesis
 	genesisDoc      *types.GenesisDoc
 	logger          *log.Logger
+
+	restartPolicy RestartPolicy
+	timeouts      Timeouts
+	supervisions  map[string]*supervision
+	monitors      map[string]context.CancelFunc
+	healthLock    sync.Mutex
+	health        map[string]*Health
+	events        *eventBus
+	logLock       sync.RWMutex
+	logs          map[string]*logSink
+	serverConfig  ServerConfig
+	ports         *PortAllocator
+	// portsAssigned is set once the services have taken their ports, so
+	// that setting up again doesn't shift them a second time. It is
+	// guarded by the operation lock.
+	portsAssigned bool
+	panelURL      string
+	// created are the directories that were created by this run, which
+	// Rollback deletes again. It is guarded by the operation lock.
+	created []string
+	// funding holds the balances that services added to an existing
+	// network are sent before they are first started. It is guarded by
+	// the operation lock.
+	funding map[string][]banktypes.Balance
+	// state is the desired state of the network that is persisted in the
+	// config directory. It is guarded by the operation lock.
+	state *ConductorState
+	// lockFile is the open lock file of the Apollo directory while this
+	// Conductor holds the lock. It is guarded by the operation lock.
+	lockFile *os.File
+	// serviceTimeouts are the timeouts of services that differ from those
+	// of the network. It is guarded by the state lock.
+	serviceTimeouts map[string]Timeouts
 }
 
 // New creates a conductor for managing the services. If there is
 // an existing genesis within the directory that is provided
-// then the genesis here will be ignored
+// then the genesis here will be ignored. Services can be provided in
+// any order; they will be started in the order of their dependencies.
 func New(dir string, genesis *genesis.Genesis, services ...Service) (*Conductor, error) {
 	if len(services) == 0 {
 		return nil, fmt.Errorf("no services provided")
 	}
 	serviceMap := make(map[string]Service)
+	names := make([]string, 0, len(services))
 	for _, service := range services {
 		name := service.Name()
 		if name == "" {
 			return nil, fmt.Errorf("service name cannot be empty")
 		}
+		if isReservedDir(name) {
+			return nil, fmt.Errorf("service name %s is reserved for the %s directory", name, name)
+		}
 		if _, ok := serviceMap[name]; ok {
 			return nil, fmt.Errorf("service %s is registered twice", name)
 		}
 		serviceMap[name] = service
+		names = append(names, name)
 	}
 
 	c := &Conductor{
 		services:        serviceMap,
-		activeEndpoints: make(map[string]string),
+		activeEndpoints: make(Endpoints),
 		activeServices:  make(map[string]Service),
 		startOrder:      make([]string, 0),
+		funding:         make(map[string][]banktypes.Balance),
 		genesis:         genesis.WithChainID(string(p2p.Private)),
 		rootDir:         dir,
 		logger:          log.New(os.Stdout, "", log.LstdFlags),
+		restartPolicy:   DefaultRestartPolicy(),
+		timeouts:        DefaultTimeouts(),
+		serviceTimeouts: make(map[string]Timeouts),
+		supervisions:    make(map[string]*supervision),
+		monitors:        make(map[string]context.CancelFunc),
+		health:          make(map[string]*Health),
+		events:          newEventBus(),
+		logs:            make(map[string]*logSink),
+		serverConfig:    DefaultServerConfig(),
+		ports:           NewPortAllocator(),
 	}
 	err := c.CheckEndpoints()
 	if err != nil {
 		return nil, err
 	}
+	c.layers, err = sortServices(names, serviceMap)
+	if err != nil {
+		return nil, err
+	}
+	c.deps = dependencies(serviceMap)
 	return c, nil
 }
 
@@ -94,22 +165,34 @@ func (c *Conductor) CheckEndpoints() error {
 // Setup initializes all services and generates the genesis
 // to be passed to each service upon startup.
 func (c *Conductor) Setup(ctx context.Context) error {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
 	c.logger.Printf("setting up services...")
+	c.trackNewDir(c.rootDir)
+	if err := c.acquireLock(); err != nil {
+		return err
+	}
 
-	configDir := filepath.Join(c.rootDir, "config")
+	if err := c.assignPorts(); err != nil {
+		return err
+	}
+
+	configDir := filepath.Join(c.rootDir, ConfigDir)
 	if _, err := os.Stat(configDir); os.IsNotExist(err) {
 		pendingGenesis, err := c.genesis.Export()
 		if err != nil {
 			return err
 		}
-		for name, service := range c.services {
+		for name := range c.services {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("setup cancelled: %w", err)
+			}
 			dir := filepath.Join(c.rootDir, name)
+			c.trackNewDir(dir)
 			if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 				return fmt.Errorf("failed to create directory for service %s: %w", name, err)
 			}
-			modifier, err := service.Setup(ctx, dir, pendingGenesis)
+			modifier, err := c.setupService(ctx, name, dir, pendingGenesis)
 			if err != nil {
 				return fmt.Errorf("failed to setup service %s: %w", name, err)
 			}
@@ -122,6 +205,7 @@ func (c *Conductor) Setup(ctx context.Context) error {
 			return err
 		}
 
+		c.trackNewDir(configDir)
 		if err := os.MkdirAll(configDir, os.ModePerm); err != nil {
 			return fmt.Errorf("failed to create directory for config: %w", err)
 		}
@@ -137,71 +221,411 @@ func (c *Conductor) Setup(ctx context.Context) error {
 			return err
 		}
 		for name := range c.services {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("setup cancelled: %w", err)
+			}
 			dir := filepath.Join(c.rootDir, name)
 			if _, err := os.Stat(dir); os.IsNotExist(err) {
-				return fmt.Errorf("new service %s added has not been setup. Please clear ~/.apollo directory and restart", dir)
+				if err := c.setupNewService(ctx, name); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := c.loadFunding(name); err != nil {
+				return err
 			}
 		}
 	}
 
+	if err := c.openLogs(); err != nil {
+		return err
+	}
+	if err := c.loadState(); err != nil {
+		return fmt.Errorf("failed to load conductor state: %w", err)
+	}
+
+	c.lock.Lock()
 	c.setup = true
+	c.lock.Unlock()
 	c.logger.Printf("services setup successfully at %s", c.rootDir)
 	return nil
 }
 
-func (c *Conductor) StartService(ctx context.Context, name string) error {
+// setupService sets up a single service within its setup timeout.
+func (c *Conductor) setupService(ctx context.Context, name, dir string, pendingGenesis *types.GenesisDoc) (genesis.Modifier, error) {
+	c.lock.RLock()
+	timeout := c.timeoutsOf(name).Setup
+	c.lock.RUnlock()
+	return callWithTimeout(ctx, timeout, "setup", func(ctx context.Context) (genesis.Modifier, error) {
+		return c.services[name].Setup(ctx, dir, pendingGenesis)
+	}, nil)
+}
+
+// Start starts all services that are not yet running. Services are
+// started in layers based on their dependencies so that every endpoint a
+// service needs is active before it is started. Services within the same
+// layer don't depend on one another and are started concurrently. If any
+// service in a layer fails to start, the following layers are not started
+// and all errors from that layer are returned.
+func (c *Conductor) Start(ctx context.Context) error {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+
 	c.lock.Lock()
-	defer c.lock.Unlock()
+	for name := range c.services {
+		if !c.isServiceRunning(name) {
+			c.resetSupervision(name)
+		}
+	}
+	c.lock.Unlock()
 
+	return c.start(ctx)
+}
+
+func (c *Conductor) start(ctx context.Context) error {
+	for _, layer := range c.layers {
+		pending := make([]string, 0, len(layer))
+		c.lock.RLock()
+		for _, name := range layer {
+			if !c.isServiceRunning(name) {
+				pending = append(pending, name)
+			}
+		}
+		c.lock.RUnlock()
+		if err := c.startServices(ctx, pending); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartOrder returns the order in which the services will be started
+// based on their dependencies.
+func (c *Conductor) StartOrder() []string {
+	order := make([]string, 0, len(c.services))
+	for _, layer := range c.layers {
+		order = append(order, layer...)
+	}
+	return order
+}
+
+func (c *Conductor) StartService(ctx context.Context, name string) error {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+
+	c.lock.Lock()
+	c.resetSupervision(name)
+	c.lock.Unlock()
 	return c.startService(ctx, name)
 }
 
-func (c *Conductor) startService(ctx context.Context, name string) error {
-	c.logger.Printf("starting up service %s", name)
-	service, exists := c.services[name]
-	if !exists {
+// StartServiceCascade starts a service together with any of the services
+// it depends on, directly or transitively, that are not running. They are
+// started in layers in the same way as Start.
+func (c *Conductor) StartServiceCascade(ctx context.Context, name string) error {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+
+	if _, ok := c.services[name]; !ok {
 		return fmt.Errorf("service %s does not exist", name)
 	}
+	return c.startSelected(ctx, closure(name, c.deps))
+}
+
+// startSelected starts the selected services that are not running in
+// layers. The caller must hold the operation lock.
+func (c *Conductor) startSelected(ctx context.Context, selected map[string]bool) error {
+	for _, layer := range c.layers {
+		pending := make([]string, 0, len(layer))
+		c.lock.Lock()
+		for _, name := range layer {
+			if selected[name] && !c.isServiceRunning(name) {
+				c.resetSupervision(name)
+				pending = append(pending, name)
+			}
+		}
+		c.lock.Unlock()
+		if err := c.startServices(ctx, pending); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Conductor) startService(ctx context.Context, name string) error {
+	return c.startServices(ctx, []string{name})
+}
+
+// startServices concurrently starts a group of services that don't depend on
+// one another. Each service receives its own copy of the active endpoints and
+// the endpoints they provide are only merged once every service in the group
+// has returned and reported that it is ready. Errors from all services are
+// joined together. The caller must hold the operation lock.
+func (c *Conductor) startServices(ctx context.Context, names []string) error {
+	c.lock.RLock()
 	if !c.setup {
+		c.lock.RUnlock()
 		return fmt.Errorf("Conductor has not setup all services. Call `Setup` first")
 	}
+	for _, name := range names {
+		service, exists := c.services[name]
+		if !exists {
+			c.lock.RUnlock()
+			return fmt.Errorf("service %s does not exist", name)
+		}
+		for _, endpoint := range service.EndpointsNeeded() {
+			if _, ok := c.activeEndpoints[endpoint]; !ok {
+				c.lock.RUnlock()
+				return fmt.Errorf("required endpoint '%s' for service '%s' is not active", endpoint, name)
+			}
+		}
+	}
+	inputs := make(Endpoints, len(c.activeEndpoints))
+	for key, value := range c.activeEndpoints {
+		inputs[key] = value
+	}
+	timeouts := make([]Timeouts, len(names))
+	for i, name := range names {
+		timeouts[i] = c.timeoutsOf(name)
+	}
+	c.lock.RUnlock()
+
+	type result struct {
+		endpoints Endpoints
+		err       error
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	// services added to an existing network are funded one at a time so
+	// that the funder's transactions don't race each other
+	for _, name := range names {
+		if err := c.fundService(ctx, name); err != nil {
+			return err
+		}
+	}
+	results := make([]result, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		inputs := inputs.copy()
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			c.logger.Printf("starting up service %s", name)
+			c.emit(EventServiceStarting, name, nil, nil)
+			service := c.services[name]
+			endpoints, err := callWithTimeout(ctx, timeouts[i].Start, "start", func(ctx context.Context) (Endpoints, error) {
+				return c.launchService(ctx, name, inputs, timeouts[i].Stop)
+			}, func(Endpoints) {
+				// the service started after it timed out, so it is stopped
+				// again to release its ports
+				if err := withTimeout(context.Background(), timeouts[i].Stop, "stop", service.Stop); err != nil {
+					c.logger.Printf("failed to stop service %s: %s", name, err.Error())
+				}
+			})
+			if err != nil {
+				results[i] = result{err: fmt.Errorf("failed to start service %s: %w", name, err)}
+				return
+			}
+			results[i] = result{endpoints: endpoints}
+		}(i, name)
+	}
+	wg.Wait()
 
-	requiredEndpoints := service.EndpointsNeeded()
-	for _, endpoint := range requiredEndpoints {
-		if _, ok := c.activeEndpoints[endpoint]; !ok {
-			return fmt.Errorf("required endpoint '%s' for service '%s' is not active", endpoint, name)
+	c.lock.Lock()
+	errs := make([]error, 0)
+	started := false
+	for i, name := range names {
+		if results[i].err != nil {
+			c.clearHealth(name)
+			c.markFailed(name, results[i].err)
+			c.emit(EventServiceFailed, name, nil, results[i].err)
+			errs = append(errs, results[i].err)
+			continue
+		}
+		// Update active endpoints after successful service start
+		for key, value := range results[i].endpoints {
+			c.activeEndpoints[key] = value
 		}
+		c.activeServices[name] = c.services[name]
+		c.startOrder = append(c.startOrder, name)
+		c.recordStarted(name, results[i].endpoints)
+		c.supervise(name)
+		c.logger.Printf("service %s started successfully on endpoints: %v", name, results[i].endpoints)
+		c.emit(EventServiceStarted, name, results[i].endpoints, nil)
+		started = true
+	}
+	if started {
+		c.emitEndpointsChanged()
+	}
+	c.lock.Unlock()
+	if started {
+		c.saveState()
 	}
+	return errors.Join(errs...)
+}
 
-	dir := filepath.Join(c.rootDir, name)
-	activeEndpoints, err := service.Start(ctx, dir, c.genesisDoc, c.activeEndpoints)
+// launchService starts a service and waits until it is ready if it is a
+// HealthChecker. If it doesn't become ready, it is stopped again within the
+// stop timeout.
+func (c *Conductor) launchService(ctx context.Context, name string, inputs Endpoints, stopTimeout time.Duration) (Endpoints, error) {
+	service := c.services[name]
+	endpoints, err := service.Start(ctx, filepath.Join(c.rootDir, name), c.genesisDoc, inputs)
 	if err != nil {
-		return fmt.Errorf("failed to start service %s: %w", name, err)
+		return nil, err
+	}
+	if checker, ok := service.(HealthChecker); ok {
+		if err := c.waitUntilReady(ctx, name, checker); err != nil {
+			if stopErr := withTimeout(context.Background(), stopTimeout, "stop", service.Stop); stopErr != nil {
+				c.logger.Printf("failed to stop service %s: %s", name, stopErr.Error())
+			}
+			return nil, err
+		}
 	}
+	return endpoints, nil
+}
+
+// StopService stops a single service. The service stays stopped when the
+// network is resumed.
+func (c *Conductor) StopService(ctx context.Context, name string) error {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
 
-	// Update active endpoints after successful service start
-	for key, value := range activeEndpoints {
-		c.activeEndpoints[key] = value
+	if err := c.stopService(ctx, name); err != nil {
+		return err
 	}
-	c.activeServices[name] = service
-	c.startOrder = append(c.startOrder, name)
-	c.logger.Printf("service %s started successfully on endpoints: %v", name, activeEndpoints)
+	c.setEnabled(false, name)
+	c.saveState()
 	return nil
 }
 
-func (c *Conductor) StopService(ctx context.Context, name string) error {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+// StopServiceCascade stops a service after stopping every service that
+// depends on it, directly or transitively, in reverse dependency order.
+// Pending restarts of crashed dependents are cancelled. The services stay
+// stopped when the network is resumed.
+func (c *Conductor) StopServiceCascade(ctx context.Context, name string) error {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+
+	if _, ok := c.services[name]; !ok {
+		return fmt.Errorf("service %s does not exist", name)
+	}
+	// the dependents are only stopped if the service itself can be
+	if !c.isStoppable(name) {
+		return fmt.Errorf("service %s is not active or does not exist", name)
+	}
+	affected := closure(name, dependents(c.deps))
+	delete(affected, name)
+	err := c.stopSelected(ctx, affected)
+	if err == nil {
+		err = c.stopService(ctx, name)
+	}
+	// the services that were stopped stay stopped even if others failed to
+	affected[name] = true
+	for service := range affected {
+		if !c.isStoppable(service) {
+			c.setEnabled(false, service)
+		}
+	}
+	c.saveState()
+	return err
+}
 
-	return c.stopService(ctx, name)
+// stopSelected stops the selected services that are running or waiting to
+// be restarted in reverse dependency order. The caller must hold the
+// operation lock.
+func (c *Conductor) stopSelected(ctx context.Context, selected map[string]bool) error {
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		for _, name := range c.layers[i] {
+			if !selected[name] || !c.isStoppable(name) {
+				continue
+			}
+			if err := c.stopService(ctx, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
+// isStoppable returns true if the service is running or has crashed and is
+// waiting to be restarted.
+func (c *Conductor) isStoppable(name string) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	record, supervised := c.supervisions[name]
+	return c.isServiceRunning(name) || (supervised && record.recovering)
+}
+
+// stopService stops a single active service. The caller must hold the
+// operation lock.
 func (c *Conductor) stopService(ctx context.Context, name string) error {
+	if err := c.checkStoppable(name); err != nil {
+		return err
+	}
+	return c.shutdownService(ctx, name)
+}
+
+// shutdownService stops a service without checking whether other services
+// depend on it. A service that fails to stop or doesn't stop within the stop
+// timeout stays active. The caller must hold the operation lock.
+func (c *Conductor) shutdownService(ctx context.Context, name string) error {
 	c.logger.Printf("stopping service %s", name)
 
+	c.lock.Lock()
+	service, exists := c.activeServices[name]
+	timeout := c.timeoutsOf(name).Stop
+	if !exists {
+		// the service has crashed and is waiting to be restarted
+		c.stopSupervising(name)
+		c.lock.Unlock()
+		c.logger.Printf("cancelled restart of crashed service %s", name)
+		return nil
+	}
+	// the supervisor would take the service stopping for a crash
+	c.stopSupervising(name)
+	c.lock.Unlock()
+
+	// Stop the service
+	c.emit(EventServiceStopping, name, nil, nil)
+	if err := withTimeout(ctx, timeout, "stop", service.Stop); err != nil {
+		err = fmt.Errorf("failed to stop service %s: %w", name, err)
+		// the service is still active, so it is supervised again
+		c.lock.Lock()
+		c.supervise(name)
+		c.lock.Unlock()
+		c.emit(EventServiceFailed, name, nil, err)
+		return err
+	}
+
+	// Update active services and endpoints
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.deactivate(name)
+	for _, endpoint := range service.EndpointsProvided() {
+		delete(c.activeEndpoints, endpoint)
+	}
+
+	c.logger.Printf("service %s stopped successfully", name)
+	c.emit(EventServiceStopped, name, nil, nil)
+	c.emitEndpointsChanged()
+
+	return nil
+}
+
+// checkStoppable returns an error if the service is neither active nor
+// waiting to be restarted, or if an active service requires any of the
+// endpoints that it provides.
+func (c *Conductor) checkStoppable(name string) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
 	// Check if the service exists and is active
 	service, exists := c.activeServices[name]
 	if !exists {
+		if record, ok := c.supervisions[name]; ok && record.recovering {
+			return nil
+		}
 		return fmt.Errorf("service %s is not active or does not exist", name)
 	}
 
@@ -220,67 +644,92 @@ func (c *Conductor) stopService(ctx context.Context, name string) error {
 			}
 		}
 	}
-
-	// Stop the service
-	if err := service.Stop(ctx); err != nil {
-		return fmt.Errorf("failed to stop service %s: %w", name, err)
-	}
-
-	// Update active services and endpoints
-	delete(c.activeServices, name)
-	for _, endpoint := range service.EndpointsProvided() {
-		delete(c.activeEndpoints, endpoint)
-	}
-
-	c.logger.Printf("service %s stopped successfully", name)
-
 	return nil
 }
 
 func (c *Conductor) Stop(ctx context.Context) error {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
 
 	return c.stop(ctx)
 }
 
+// stop stops all running services, each before the services it depends on.
+// A service that fails to stop doesn't prevent the services it depends on
+// from being stopped, so that they release their ports and directories. The
+// errors of all services that failed to stop are returned.
 func (c *Conductor) stop(ctx context.Context) error {
-	for i := len(c.startOrder) - 1; i >= 0; i-- {
-		if !c.isServiceRunning(c.startOrder[i]) {
-			continue
+	var errs []error
+	for i := len(c.layers) - 1; i >= 0; i-- {
+		for _, name := range c.layers[i] {
+			if !c.IsServiceRunning(name) {
+				continue
+			}
+			if err := c.shutdownService(ctx, name); err != nil {
+				errs = append(errs, err)
+			}
 		}
-		if err := c.stopService(ctx, c.startOrder[i]); err != nil {
-			return err
+	}
+	// cancel any pending restarts of crashed services, while services
+	// that failed to stop stay supervised
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for name := range c.monitors {
+		if _, active := c.activeServices[name]; !active {
+			c.stopSupervising(name)
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 func (c *Conductor) Cleanup() error {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	if len(c.activeServices) > 0 {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+	c.lock.RLock()
+	active := len(c.activeServices)
+	c.lock.RUnlock()
+	if active > 0 {
 		return fmt.Errorf("cannot cleanup Conductor with active services")
 	}
 
 	c.logger.Printf("cleaning up all services at %s", c.rootDir)
+	c.closeLogs()
+	if err := c.releaseLock(); err != nil {
+		return err
+	}
 	return os.RemoveAll(c.rootDir)
 }
 
+// Endpoints returns all endpoints provided by the active services.
+func (c *Conductor) Endpoints() Endpoints {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.activeEndpoints.copy()
+}
+
 func (c *Conductor) IsServiceRunning(name string) bool {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return c.isServiceRunning(name)
 }
 
+// deactivate removes a service that stopped or crashed from the active
+// services. The caller must hold the state lock.
+func (c *Conductor) deactivate(name string) {
+	delete(c.activeServices, name)
+	c.startOrder = slices.DeleteFunc(c.startOrder, func(started string) bool {
+		return started == name
+	})
+}
+
 func (c *Conductor) isServiceRunning(name string) bool {
 	_, exists := c.activeServices[name]
 	return exists
 }
 
 func (c *Conductor) ServiceStatus() map[string]Status {
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 
 	return c.serviceStatus()
 }
@@ -290,11 +739,22 @@ func (c *Conductor) serviceStatus() map[string]Status {
 	for name, service := range c.services {
 		status := Status{
 			RequiredEndpoints: service.EndpointsNeeded(),
-			ProvidesEndpoints: make(map[string]string),
+			ProvidesEndpoints: make(Endpoints),
 		}
 		if _, ok := c.activeServices[name]; ok {
 			status.Running = true
 		}
+		c.healthLock.Lock()
+		if health, ok := c.health[name]; ok {
+			status.Health = health.copy()
+		}
+		c.healthLock.Unlock()
+		if record, ok := c.supervisions[name]; ok {
+			status.Restarts = record.restarts
+			status.LastError = record.lastError
+			status.Recovering = record.recovering
+			status.Failed = record.failed
+		}
 		for _, providedEndpoint := range service.EndpointsProvided() {
 			endpoint, ok := c.activeEndpoints[providedEndpoint]
 			if !ok {
@@ -310,11 +770,17 @@ func (c *Conductor) serviceStatus() map[string]Status {
 // Serve starts the web server for the conductor, visualising the current
 // running services and providing a GUI for basic control of all services.
 func (c *Conductor) Serve(ctx context.Context) error {
-	c.lock.Lock()
-	defer c.lock.Unlock()
-	if !c.setup {
+	c.lock.RLock()
+	setup := c.setup
+	cfg := c.serverConfig
+	ports := c.ports
+	c.lock.RUnlock()
+	if !setup {
 		return fmt.Errorf("Conductor has not setup the services. Call `Setup` first")
 	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid server config: %w", err)
+	}
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	mux := http.NewServeMux()
@@ -324,7 +790,7 @@ func (c *Conductor) Serve(ctx context.Context) error {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		status := c.serviceStatus()
+		status := c.ServiceStatus()
 		statusJSON, err := json.Marshal(status)
 		if err != nil {
 			http.Error(w, "Failed to marshal status", http.StatusInternalServerError)
@@ -337,6 +803,27 @@ func (c *Conductor) Serve(ctx context.Context) error {
 		c.logger.Printf("served status response")
 	})
 
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		c.serveEvents(ctx, w, r)
+	})
+
+	mux.HandleFunc("/logs/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pathParts := strings.Split(r.URL.Path, "/")
+		if len(pathParts) < 3 || pathParts[2] == "" {
+			http.Error(w, "Service name is required in the URL path. For example /logs/consensus-node", http.StatusBadRequest)
+			return
+		}
+		c.serveLogs(ctx, w, r, pathParts[2])
+	})
+
 	mux.HandleFunc("/start/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -349,7 +836,16 @@ func (c *Conductor) Serve(ctx context.Context) error {
 			return
 		}
 		serviceName := pathParts[2]
-		if err := c.startService(ctx, serviceName); err != nil {
+		cascade, err := boolParam(r, "cascade")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		start := c.StartService
+		if cascade {
+			start = c.StartServiceCascade
+		}
+		if err := start(ctx, serviceName); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			c.logger.Printf("failed to start service %s: %s", serviceName, err.Error())
 			return
@@ -369,7 +865,16 @@ func (c *Conductor) Serve(ctx context.Context) error {
 			return
 		}
 		serviceName := pathParts[2]
-		if err := c.stopService(ctx, serviceName); err != nil {
+		cascade, err := boolParam(r, "cascade")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stop := c.StopService
+		if cascade {
+			stop = c.StopServiceCascade
+		}
+		if err := stop(ctx, serviceName); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			c.logger.Printf("failed to stop service %s: %s", serviceName, err.Error())
 			return
@@ -377,12 +882,100 @@ func (c *Conductor) Serve(ctx context.Context) error {
 		w.WriteHeader(http.StatusOK)
 	})
 
+	mux.HandleFunc("/restart/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pathParts := strings.Split(r.URL.Path, "/")
+		if len(pathParts) < 3 || pathParts[2] == "" {
+			http.Error(w, "Service name is required in the URL path. For example /restart/consensus-node", http.StatusBadRequest)
+			c.logger.Printf("received bad request to restart service")
+			return
+		}
+		serviceName := pathParts[2]
+		opts, err := restartParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.RestartService(ctx, serviceName, opts...); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			c.logger.Printf("failed to restart service %s: %s", serviceName, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux.HandleFunc("/restart-all/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		opts, err := restartParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.Restart(ctx, opts...); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			c.logger.Printf("failed to restart: %s", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux.HandleFunc("/snapshots", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		manifests, err := ListSnapshots(c.rootDir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		c.writeJSON(w, manifests)
+	})
+
+	mux.HandleFunc("/snapshot/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pathParts := strings.Split(r.URL.Path, "/")
+		if len(pathParts) < 4 || pathParts[3] == "" {
+			http.Error(w, "Action and snapshot name are required in the URL path. For example /snapshot/save/height-500", http.StatusBadRequest)
+			return
+		}
+		action, name := pathParts[2], pathParts[3]
+		var (
+			manifest *SnapshotManifest
+			err      error
+		)
+		switch action {
+		case "save":
+			manifest, err = c.SaveSnapshot(ctx, name)
+		case "restore":
+			manifest, err = c.RestoreSnapshot(ctx, name)
+		default:
+			http.Error(w, fmt.Sprintf("unknown snapshot action %s, use save or restore", action), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			c.logger.Printf("failed to %s snapshot %s: %s", action, name, err.Error())
+			return
+		}
+		c.writeJSON(w, manifest)
+	})
+
 	mux.HandleFunc("/shutdown/", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		err := c.stop(ctx)
+		err := c.Stop(ctx)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			c.logger.Printf("failed to shutdown: %s", err.Error())
@@ -398,11 +991,41 @@ func (c *Conductor) Serve(ctx context.Context) error {
 	}
 	mux.Handle("/", http.FileServer(http.FS(fileSystem)))
 
+	address := cfg.ListenAddress
+	if !cfg.FixedPort {
+		address, err = ports.Address(cfg.ListenAddress)
+		if err != nil {
+			return fmt.Errorf("failed to assign port to control panel: %w", err)
+		}
+	}
 	server := &http.Server{
-		Addr:    "0.0.0.0:8080",
-		Handler: mux,
+		Addr:         address,
+		Handler:      mux,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
 	}
 
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	url := panelURL(listener.Addr(), cfg.TLS())
+	if err := writePanelAddress(c.rootDir, url); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to write control panel address: %w", err)
+	}
+	c.lock.Lock()
+	c.panelURL = url
+	c.lock.Unlock()
+	defer func() {
+		c.lock.Lock()
+		c.panelURL = ""
+		c.lock.Unlock()
+		if err := os.Remove(filepath.Join(c.rootDir, PanelAddressFile)); err != nil && !os.IsNotExist(err) {
+			c.logger.Printf("failed to remove control panel address: %s", err.Error())
+		}
+	}()
+
 	go func() {
 		<-ctx.Done()
 		if err := server.Shutdown(context.Background()); err != nil {
@@ -411,16 +1034,77 @@ func (c *Conductor) Serve(ctx context.Context) error {
 		c.logger.Printf("control panel server shutdown successfully")
 	}()
 
-	c.logger.Printf("starting service control panel on %s", server.Addr)
-	err = server.ListenAndServe()
-	if errors.Is(err, http.ErrServerClosed) && ctx.Err() != nil {
+	c.logger.Printf("starting service control panel on %s", url)
+	if cfg.TLS() {
+		err = server.ServeTLS(listener, cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = server.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
 		return ctx.Err()
 	}
-	return nil
+	return err
+}
+
+// writeJSON writes a value as the JSON body of a response.
+func (c *Conductor) writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		c.logger.Printf("failed to write response: %s", err.Error())
+	}
+}
+
+// restartParams reads the options of the /restart/ and /restart-all/
+// endpoints. reload=true reloads the configuration of the services.
+func restartParams(r *http.Request) ([]RestartOption, error) {
+	reload, err := boolParam(r, "reload")
+	if err != nil || !reload {
+		return nil, err
+	}
+	return []RestartOption{WithConfigReload()}, nil
+}
+
+// boolParam reads an optional boolean query parameter, such as cascade on
+// the /start/ and /stop/ endpoints.
+func boolParam(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for %s: %q", name, value)
+	}
+	return parsed, nil
+}
+
+// PanelAddress returns the URL of the control panel while it is being
+// served and an empty string otherwise.
+func (c *Conductor) PanelAddress() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.panelURL
 }
 
 type Status struct {
 	Running           bool      `json:"running"`
 	ProvidesEndpoints Endpoints `json:"provides_endpoints"`
 	RequiredEndpoints []string  `json:"required_endpoints"`
+	// Health is only set for running services that implement HealthChecker
+	Health *Health `json:"health,omitempty"`
+	// Restarts is the number of times the service has been automatically
+	// restarted after crashing since it was last started manually.
+	Restarts int `json:"restarts"`
+	// LastError is the most recent crash or failure to start
+	LastError string `json:"last_error,omitempty"`
+	// Recovering is true while the service is waiting to be restarted
+	Recovering bool `json:"recovering,omitempty"`
+	// Failed is true if the service failed to start, or has crashed and
+	// could not be restarted
+	Failed bool `json:"failed,omitempty"`
 }
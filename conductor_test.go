@@ -0,0 +1,1156 @@
+package apollo
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/celestiaorg/apollo/genesis"
+	blobtypes "github.com/celestiaorg/celestia-app/x/blob/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/tendermint/types"
+)
+
+var _ Service = &mockService{}
+
+// mockService is a lightweight service that provides each of its endpoints
+// under the address "<name>/<endpoint>".
+type mockService struct {
+	name     string
+	needed   []string
+	provided []string
+	// onStart, if set, is called at the beginning of Start
+	onStart func(context.Context) error
+	// onStop, if set, is called by Stop
+	onStop func(context.Context) error
+	// modifier is returned by Setup
+	modifier genesis.Modifier
+}
+
+func newMockService(name string, needed []string, provided ...string) *mockService {
+	return &mockService{name: name, needed: needed, provided: provided}
+}
+
+func (s *mockService) Name() string                { return s.name }
+func (s *mockService) EndpointsNeeded() []string   { return s.needed }
+func (s *mockService) EndpointsProvided() []string { return s.provided }
+
+func (s *mockService) Setup(context.Context, string, *types.GenesisDoc) (genesis.Modifier, error) {
+	return s.modifier, nil
+}
+
+func (s *mockService) Start(ctx context.Context, _ string, _ *types.GenesisDoc, inputs Endpoints) (Endpoints, error) {
+	if s.onStart != nil {
+		if err := s.onStart(ctx); err != nil {
+			return nil, err
+		}
+	}
+	endpoints := make(Endpoints)
+	for _, endpoint := range s.provided {
+		endpoints[endpoint] = mockEndpoint(s.name, endpoint)
+	}
+	return endpoints, nil
+}
+
+func (s *mockService) Stop(ctx context.Context) error {
+	if s.onStop != nil {
+		return s.onStop(ctx)
+	}
+	return nil
+}
+
+func mockEndpoint(service, endpoint string) Endpoint {
+	return Endpoint{Host: service, Path: "/" + endpoint}
+}
+
+func TestStartOrder(t *testing.T) {
+	// provided in reverse order of their dependencies
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(),
+		newMockService("light", []string{"rpc", "p2p"}, "light-rpc"),
+		newMockService("faucet", []string{"grpc"}, "faucet-api"),
+		newMockService("bridge", []string{"rpc", "grpc"}, "p2p"),
+		newMockService("consensus", nil, "rpc", "grpc"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{"consensus", "faucet", "bridge", "light"}, c.StartOrder())
+
+	ctx := context.Background()
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Start(ctx))
+	for _, name := range c.StartOrder() {
+		require.True(t, c.IsServiceRunning(name))
+	}
+	require.NoError(t, c.Stop(ctx))
+}
+
+func TestCascade(t *testing.T) {
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(),
+		newMockService("consensus", nil, "rpc", "grpc"),
+		newMockService("faucet", []string{"grpc"}, "faucet-api"),
+		newMockService("bridge", []string{"rpc", "grpc"}, "p2p"),
+		newMockService("light", []string{"rpc", "p2p"}, "light-rpc"),
+	)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, c.Setup(ctx))
+
+	require.ErrorContains(t, c.StartService(ctx, "light"), "is not active")
+	require.NoError(t, c.StartServiceCascade(ctx, "light"))
+	for name, running := range map[string]bool{"consensus": true, "bridge": true, "light": true, "faucet": false} {
+		require.Equal(t, running, c.IsServiceRunning(name), name)
+	}
+
+	require.NoError(t, c.StartService(ctx, "faucet"))
+	require.ErrorContains(t, c.StopService(ctx, "consensus"), "provides required endpoint")
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := c.Subscribe(subCtx)
+	require.NoError(t, c.StopServiceCascade(ctx, "bridge"))
+	require.True(t, c.IsServiceRunning("consensus"))
+	require.True(t, c.IsServiceRunning("faucet"))
+	require.NoError(t, c.StopServiceCascade(ctx, "consensus"))
+
+	var stopped []string
+	for len(stopped) < 4 {
+		if event := <-events; event.Type == EventServiceStopped {
+			stopped = append(stopped, event.Service)
+		}
+	}
+	require.Equal(t, []string{"light", "bridge", "faucet", "consensus"}, stopped)
+
+	// the dependents of a service that isn't running are left alone
+	require.NoError(t, c.StartServiceCascade(ctx, "light"))
+	c.lock.Lock()
+	c.deactivate("bridge")
+	c.lock.Unlock()
+	require.ErrorContains(t, c.StopServiceCascade(ctx, "bridge"), "is not active")
+	require.True(t, c.IsServiceRunning("light"))
+}
+
+// reloadingService is a mockService that counts how often it was started
+// and how often it reloaded its config.
+type reloadingService struct {
+	*mockService
+	starts  int
+	reloads int
+}
+
+func newReloadingService(name string, needed []string, provided ...string) *reloadingService {
+	s := &reloadingService{mockService: newMockService(name, needed, provided...)}
+	s.onStart = func(context.Context) error {
+		s.starts++
+		return nil
+	}
+	return s
+}
+
+func (s *reloadingService) ReloadConfig(string) error {
+	s.reloads++
+	return nil
+}
+
+func TestRestartService(t *testing.T) {
+	consensus := newReloadingService("consensus", nil, "rpc", "grpc")
+	faucet := newReloadingService("faucet", []string{"grpc"}, "faucet-api")
+	bridge := newReloadingService("bridge", []string{"rpc", "grpc"}, "p2p")
+	light := newReloadingService("light", []string{"rpc", "p2p"}, "light-rpc")
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(), consensus, faucet, bridge, light)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.StartServiceCascade(ctx, "light"))
+
+	// the faucet isn't running so it stays stopped
+	require.NoError(t, c.RestartService(ctx, "consensus"))
+	for _, s := range []*reloadingService{consensus, bridge, light} {
+		require.Equal(t, 2, s.starts, s.name)
+		require.True(t, c.IsServiceRunning(s.name), s.name)
+		require.Zero(t, s.reloads, s.name)
+	}
+	require.False(t, c.IsServiceRunning("faucet"))
+
+	require.NoError(t, c.RestartService(ctx, "bridge", WithConfigReload()))
+	require.Equal(t, 2, consensus.starts)
+	require.Equal(t, []int{1, 1}, []int{bridge.reloads, light.reloads})
+	require.Equal(t, 3, light.starts)
+
+	// restarting the network doesn't start the faucet either
+	require.NoError(t, c.Restart(ctx, WithConfigReload()))
+	for _, s := range []*reloadingService{consensus, bridge, light} {
+		require.True(t, c.IsServiceRunning(s.name), s.name)
+	}
+	require.False(t, c.IsServiceRunning("faucet"))
+	require.Equal(t, []int{1, 0, 2, 2}, []int{consensus.reloads, faucet.reloads, bridge.reloads, light.reloads})
+	require.Equal(t, mockEndpoint("bridge", "p2p"), c.Endpoints()["p2p"])
+
+	require.ErrorContains(t, c.RestartService(ctx, "rollup"), "does not exist")
+}
+
+// fundingService is a mockService that records the balances it was asked
+// to fund.
+type fundingService struct {
+	*mockService
+	funded []banktypes.Balance
+}
+
+func (s *fundingService) Fund(_ context.Context, balances []banktypes.Balance) error {
+	s.funded = append(s.funded, balances...)
+	return nil
+}
+
+func TestAddServiceToExistingNetwork(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	consensus := &fundingService{mockService: newMockService("consensus", nil, "grpc")}
+	c, err := New(dir, genesis.NewDefaultGenesis(), consensus)
+	require.NoError(t, err)
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Close())
+
+	address := sdk.AccAddress(make([]byte, 20))
+	coin := sdk.NewInt64Coin("utia", 1000)
+	faucet := newMockService("faucet", []string{"grpc"}, "faucet-api")
+	faucet.modifier = genesis.FundAccounts(Codec().Codec, []sdk.AccAddress{address}, coin)
+	light := newMockService("light", []string{"grpc"}, "light-rpc")
+	c, err = New(dir, genesis.NewDefaultGenesis(), consensus, faucet, light)
+	require.NoError(t, err)
+	require.NoError(t, c.Setup(ctx))
+	require.FileExists(t, filepath.Join(dir, "faucet", fundingFile))
+	require.NoError(t, c.Close())
+
+	// the pending funding survives setting up the network again
+	c, err = New(dir, genesis.NewDefaultGenesis(), consensus, faucet, light)
+	require.NoError(t, err)
+	require.NoError(t, c.Setup(ctx))
+	require.ErrorContains(t, c.StartService(ctx, "faucet"), "is not active")
+	require.NoError(t, c.Start(ctx))
+	require.Equal(t, []banktypes.Balance{{Address: address.String(), Coins: sdk.NewCoins(coin)}}, consensus.funded)
+	require.NoFileExists(t, filepath.Join(dir, "faucet", fundingFile))
+
+	// services are only funded once
+	require.NoError(t, c.StopService(ctx, "faucet"))
+	require.NoError(t, c.StartService(ctx, "faucet"))
+	require.Len(t, consensus.funded, 1)
+	require.NoError(t, c.Stop(ctx))
+	require.NoError(t, c.Close())
+
+	params := blobtypes.DefaultParams()
+	params.GovMaxSquareSize = 128
+	rollup := newMockService("rollup", []string{"grpc"})
+	rollup.modifier = genesis.SetBlobParams(Codec().Codec, params)
+	c, err = New(dir, genesis.NewDefaultGenesis(), consensus, rollup)
+	require.NoError(t, err)
+	require.ErrorContains(t, c.Setup(ctx), "changes the blob genesis state")
+	require.NoDirExists(t, filepath.Join(dir, "rollup"))
+}
+
+func TestRollbackNewRoot(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "apollo")
+	bridge := newMockService("bridge", []string{"rpc"}, "p2p")
+	bridge.onStart = func(context.Context) error { return errors.New("bridge failed") }
+	c, err := New(dir, genesis.NewDefaultGenesis(), newMockService("consensus", nil, "rpc"), bridge)
+	require.NoError(t, err)
+	require.ErrorContains(t, c.Run(context.Background()), "bridge failed")
+	require.False(t, c.IsServiceRunning("consensus"))
+	require.NoDirExists(t, dir)
+}
+
+func TestRollbackExistingRoot(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	c, err := New(dir, genesis.NewDefaultGenesis(), newMockService("consensus", nil, "rpc"))
+	require.NoError(t, err)
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Close())
+
+	bridge := newMockService("bridge", []string{"rpc"}, "p2p")
+	bridge.onStart = func(context.Context) error { return errors.New("bridge failed") }
+	c, err = New(dir, genesis.NewDefaultGenesis(), newMockService("consensus", nil, "rpc"), bridge)
+	require.NoError(t, err)
+	require.ErrorContains(t, c.Run(ctx), "bridge failed")
+	require.False(t, c.IsServiceRunning("consensus"))
+	require.FileExists(t, filepath.Join(dir, "config", "genesis.json"))
+	require.DirExists(t, filepath.Join(dir, "consensus"))
+	require.NoDirExists(t, filepath.Join(dir, "bridge"))
+
+	data, err := os.ReadFile(filepath.Join(dir, StartupReportFile))
+	require.NoError(t, err)
+	var report StartupReport
+	require.NoError(t, json.Unmarshal(data, &report))
+	require.Contains(t, report.Error, "bridge failed")
+	require.Equal(t, []string{filepath.Join(dir, "bridge")}, report.Removed)
+	require.True(t, report.Services["consensus"].Running)
+	require.False(t, report.Services["bridge"].Running)
+}
+
+func TestResume(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	services := func() []Service {
+		return []Service{
+			newMockService("consensus", nil, "rpc"),
+			newMockService("bridge", []string{"rpc"}, "p2p"),
+			newMockService("light", []string{"p2p"}, "light-rpc"),
+		}
+	}
+	c, err := New(dir, genesis.NewDefaultGenesis(), services()...)
+	require.NoError(t, err)
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Resume(ctx))
+	require.True(t, c.IsServiceRunning("light"))
+	require.NoError(t, c.StopService(ctx, "light"))
+	require.NoError(t, c.Stop(ctx))
+	require.NoError(t, c.Close())
+
+	state, err := ReadState(dir)
+	require.NoError(t, err)
+	require.False(t, state.Services["light"].Enabled)
+	require.True(t, state.Services["bridge"].Enabled)
+	require.Equal(t, mockEndpoint("consensus", "rpc").String(), state.Services["consensus"].Endpoints["rpc"].String())
+	require.Equal(t, []string{"consensus", "bridge"}, state.StartOrder)
+
+	// the stopped service stays stopped when the network is run again
+	c, err = New(dir, genesis.NewDefaultGenesis(), services()...)
+	require.NoError(t, err)
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Resume(ctx))
+	require.True(t, c.IsServiceRunning("consensus"))
+	require.True(t, c.IsServiceRunning("bridge"))
+	require.False(t, c.IsServiceRunning("light"))
+
+	// stopping a service with its dependents disables all of them
+	require.NoError(t, c.StopServiceCascade(ctx, "consensus"))
+	require.NoError(t, c.StartService(ctx, "consensus"))
+	require.NoError(t, c.Stop(ctx))
+	require.NoError(t, c.Close())
+	c, err = New(dir, genesis.NewDefaultGenesis(), services()...)
+	require.NoError(t, err)
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Resume(ctx))
+	require.True(t, c.IsServiceRunning("consensus"))
+	require.False(t, c.IsServiceRunning("bridge"))
+	require.NoError(t, c.Stop(ctx))
+}
+
+func TestStopCollectsErrors(t *testing.T) {
+	ctx := context.Background()
+	var (
+		orderLock sync.Mutex
+		order     []string
+	)
+	stopped := func(name string) {
+		orderLock.Lock()
+		defer orderLock.Unlock()
+		order = append(order, name)
+	}
+	consensus := newMockService("consensus", nil, "rpc")
+	consensus.onStop = func(context.Context) error {
+		stopped("consensus")
+		return nil
+	}
+	bridge := newMockService("bridge", []string{"rpc"}, "p2p")
+	bridge.onStop = func(context.Context) error {
+		stopped("bridge")
+		return errors.New("bridge failed")
+	}
+	light := newMockService("light", []string{"p2p"}, "light-rpc")
+	hung := make(chan struct{})
+	defer close(hung)
+	light.onStop = func(context.Context) error {
+		stopped("light")
+		<-hung
+		return nil
+	}
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(), bridge, consensus, light)
+	require.NoError(t, err)
+	c.WithTimeouts(Timeouts{Stop: 50 * time.Millisecond})
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Start(ctx))
+
+	err = c.Stop(ctx)
+	require.ErrorContains(t, err, "failed to stop service light: stop timed out after 50ms")
+	require.ErrorContains(t, err, "failed to stop service bridge: bridge failed")
+	orderLock.Lock()
+	require.Equal(t, []string{"light", "bridge", "consensus"}, order)
+	orderLock.Unlock()
+	// the services that failed to stop don't keep the ones they depend on
+	// running
+	require.False(t, c.IsServiceRunning("consensus"))
+	require.True(t, c.IsServiceRunning("bridge"))
+	require.True(t, c.IsServiceRunning("light"))
+	// and are still supervised
+	c.lock.RLock()
+	require.Contains(t, c.monitors, "bridge")
+	require.Contains(t, c.monitors, "light")
+	c.lock.RUnlock()
+}
+
+// stuckSetupService blocks in Setup, ignoring its context, until release
+// is closed.
+type stuckSetupService struct {
+	*mockService
+	release chan struct{}
+}
+
+func (s *stuckSetupService) Setup(context.Context, string, *types.GenesisDoc) (genesis.Modifier, error) {
+	<-s.release
+	return nil, nil
+}
+
+func TestTimeouts(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	stuck := newMockService("stuck", nil, "stuck-api")
+	stuck.onStart = func(context.Context) error {
+		<-release
+		return nil
+	}
+	var stopped sync.WaitGroup
+	stopped.Add(1)
+	stuck.onStop = func(context.Context) error {
+		stopped.Done()
+		return nil
+	}
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(), stuck, newMockService("other", nil))
+	require.NoError(t, err)
+	c.WithServiceTimeouts("stuck", Timeouts{Start: 50 * time.Millisecond})
+	require.NoError(t, c.Setup(ctx))
+
+	err = c.Start(ctx)
+	require.ErrorContains(t, err, "failed to start service stuck: start timed out after 50ms")
+	status := c.ServiceStatus()
+	require.False(t, status["stuck"].Running)
+	require.True(t, status["stuck"].Failed)
+	require.Contains(t, status["stuck"].LastError, "start timed out")
+	require.True(t, status["other"].Running)
+	// a service that starts after timing out is stopped again
+	close(release)
+	stopped.Wait()
+	require.NoError(t, c.Stop(ctx))
+	require.NoError(t, c.Close())
+
+	setup := &stuckSetupService{mockService: newMockService("setup", nil), release: make(chan struct{})}
+	defer close(setup.release)
+	c, err = New(t.TempDir(), genesis.NewDefaultGenesis(), setup)
+	require.NoError(t, err)
+	c.WithTimeouts(Timeouts{Setup: 50 * time.Millisecond})
+	require.ErrorContains(t, c.Setup(ctx), "failed to setup service setup: setup timed out after 50ms")
+	require.NoError(t, c.Close())
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	c, err = New(t.TempDir(), genesis.NewDefaultGenesis(), newMockService("consensus", nil))
+	require.NoError(t, err)
+	require.ErrorContains(t, c.Setup(cancelled), "setup cancelled")
+	require.NoError(t, c.Close())
+
+	// waiting for a service to become ready is limited by its start timeout
+	never := &healthyMockService{
+		mockService: newMockService("never", nil),
+		health:      func(context.Context) error { return errors.New("not ready") },
+	}
+	c, err = New(t.TempDir(), genesis.NewDefaultGenesis(), never)
+	require.NoError(t, err)
+	c.WithServiceTimeouts("never", Timeouts{Start: 300 * time.Millisecond})
+	require.NoError(t, c.Setup(ctx))
+	require.ErrorContains(t, c.Start(ctx), "start timed out after 300ms: service never did not become ready: not ready")
+	require.NoError(t, c.Close())
+}
+
+func TestInstanceLock(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	c, err := New(dir, genesis.NewDefaultGenesis(), newMockService("consensus", nil, "rpc"))
+	require.NoError(t, err)
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, PanelAddressFile), []byte("http://localhost:8080"), 0o644))
+
+	other, err := New(dir, genesis.NewDefaultGenesis(), newMockService("consensus", nil, "rpc"))
+	require.NoError(t, err)
+	err = other.Run(ctx)
+	require.ErrorContains(t, err, fmt.Sprintf("in use by process %d with its control panel at http://localhost:8080", os.Getpid()))
+	require.NoFileExists(t, filepath.Join(dir, StartupReportFile), "the network in use is not rolled back")
+	_, err = LockDir(dir)
+	require.ErrorIs(t, err, ErrInUse)
+
+	require.NoError(t, c.Close())
+	release, err := LockDir(dir)
+	require.NoError(t, err)
+	require.ErrorIs(t, other.Setup(ctx), ErrInUse)
+	require.NoError(t, release())
+	require.NoError(t, other.Setup(ctx))
+	require.NoError(t, other.Close())
+
+	// a lock file left behind by a process that crashed doesn't hold the lock
+	require.NoError(t, os.WriteFile(filepath.Join(dir, LockFile), []byte("999999\n"), 0o644))
+	require.NoError(t, c.Setup(ctx))
+	data, err := os.ReadFile(filepath.Join(dir, LockFile))
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("%d\n", os.Getpid()), string(data))
+	require.NoError(t, c.Close())
+}
+
+func TestRestoreSnapshotRejectsLinks(t *testing.T) {
+	outside := t.TempDir()
+	for name, entries := range map[string][]*tar.Header{
+		"absolute": {{Name: "data/x", Typeflag: tar.TypeSymlink, Linkname: outside}},
+		"relative": {{Name: "data/x", Typeflag: tar.TypeSymlink, Linkname: "../../.."}},
+		"through-link": {
+			{Name: "data/consensus/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "data/x", Typeflag: tar.TypeSymlink, Linkname: "consensus"},
+			{Name: "data/x/file", Typeflag: tar.TypeReg, Mode: 0o644},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(root, SnapshotsDir), os.ModePerm))
+			f, err := os.Create(SnapshotPath(root, name))
+			require.NoError(t, err)
+			gz := gzip.NewWriter(f)
+			tw := tar.NewWriter(gz)
+			manifest := []byte(`{"name":"` + name + `"}`)
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: manifestName, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(manifest))}))
+			_, err = tw.Write(manifest)
+			require.NoError(t, err)
+			for _, header := range entries {
+				require.NoError(t, tw.WriteHeader(header))
+			}
+			require.NoError(t, tw.Close())
+			require.NoError(t, gz.Close())
+			require.NoError(t, f.Close())
+
+			_, err = RestoreSnapshot(root, name)
+			require.ErrorContains(t, err, "invalid")
+			entries, err := os.ReadDir(outside)
+			require.NoError(t, err)
+			require.Empty(t, entries)
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	consensus := newMockService("consensus", nil, "rpc")
+	stops := 0
+	consensus.onStop = func(context.Context) error {
+		stops++
+		return nil
+	}
+	c, err := New(dir, genesis.NewDefaultGenesis(), consensus, newMockService("bridge", []string{"rpc"}, "p2p"))
+	require.NoError(t, err)
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.StartService(ctx, "consensus"))
+
+	state := filepath.Join(dir, "consensus", "state")
+	require.NoError(t, os.WriteFile(state, []byte("height 500"), 0o644))
+	manifest, err := c.SaveSnapshot(ctx, "height-500")
+	require.NoError(t, err)
+	require.Equal(t, []string{"bridge", "consensus"}, manifest.Services)
+	require.True(t, c.IsServiceRunning("consensus"))
+	require.False(t, c.IsServiceRunning("bridge"))
+	_, err = c.SaveSnapshot(ctx, "height-500")
+	require.ErrorContains(t, err, "already exists")
+	_, err = c.SaveSnapshot(ctx, "../escape")
+	require.ErrorContains(t, err, "invalid snapshot name")
+	require.Equal(t, 1, stops, "the network should only be stopped for snapshots that can be saved")
+
+	require.NoError(t, os.WriteFile(state, []byte("height 900"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "consensus", "extra"), nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, PanelAddressFile), []byte("http://localhost:8080"), 0o644))
+	_, err = c.RestoreSnapshot(ctx, "unknown")
+	require.Error(t, err)
+	require.True(t, c.IsServiceRunning("consensus"))
+
+	manifest, err = c.RestoreSnapshot(ctx, "height-500")
+	require.NoError(t, err)
+	require.Equal(t, "height-500", manifest.Name)
+	require.True(t, c.IsServiceRunning("consensus"))
+	data, err := os.ReadFile(state)
+	require.NoError(t, err)
+	require.Equal(t, "height 500", string(data))
+	require.NoFileExists(t, filepath.Join(dir, "consensus", "extra"))
+	require.FileExists(t, filepath.Join(dir, PanelAddressFile))
+	require.FileExists(t, filepath.Join(dir, "consensus", LogFileName))
+
+	manifests, err := ListSnapshots(dir)
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	require.Equal(t, manifest.ChainID, manifests[0].ChainID)
+	entries, err := os.ReadDir(filepath.Join(dir, SnapshotsDir))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "temporary files should be removed")
+	require.NoError(t, c.Stop(ctx))
+
+	_, err = New(dir, genesis.NewDefaultGenesis(), newMockService(SnapshotsDir, nil))
+	require.ErrorContains(t, err, "reserved")
+}
+
+func TestDependencyCycle(t *testing.T) {
+	_, err := New(t.TempDir(), genesis.NewDefaultGenesis(),
+		newMockService("a", []string{"b-api"}, "a-api"),
+		newMockService("b", []string{"c-api"}, "b-api"),
+		newMockService("c", []string{"a-api"}, "c-api"),
+	)
+	require.ErrorContains(t, err, "a -> b -> c -> a")
+}
+
+func TestStartLayerConcurrently(t *testing.T) {
+	// bridge and faucet only depend on consensus so they should be started
+	// at the same time. Each one waits for the other to have been called.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	waitForPeer := func(context.Context) error {
+		wg.Done()
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("services were not started concurrently")
+		}
+	}
+	bridge := newMockService("bridge", []string{"rpc"}, "p2p")
+	bridge.onStart = waitForPeer
+	faucet := newMockService("faucet", []string{"rpc"}, "faucet-api")
+	faucet.onStart = waitForPeer
+
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(),
+		newMockService("consensus", nil, "rpc"), bridge, faucet,
+	)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Start(ctx))
+	require.True(t, c.IsServiceRunning("bridge"))
+	require.True(t, c.IsServiceRunning("faucet"))
+}
+
+func TestStartLayerJoinsErrors(t *testing.T) {
+	failing := func(name string) *mockService {
+		service := newMockService(name, []string{"rpc"})
+		service.onStart = func(context.Context) error {
+			return errors.New("boom")
+		}
+		return service
+	}
+
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(),
+		newMockService("consensus", nil, "rpc"),
+		failing("bridge"),
+		failing("faucet"),
+		newMockService("ok", []string{"rpc"}),
+	)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, c.Setup(ctx))
+	err = c.Start(ctx)
+	require.ErrorContains(t, err, "failed to start service bridge: boom")
+	require.ErrorContains(t, err, "failed to start service faucet: boom")
+	require.True(t, c.IsServiceRunning("ok"))
+	require.NoError(t, c.Stop(ctx))
+}
+
+// healthyMockService is a mockService that implements the HealthChecker
+// interface.
+type healthyMockService struct {
+	*mockService
+	health func(context.Context) error
+}
+
+func (s *healthyMockService) Health(ctx context.Context) error { return s.health(ctx) }
+
+func TestWaitForReadiness(t *testing.T) {
+	probes := 0
+	slow := &healthyMockService{
+		mockService: newMockService("slow", nil, "slow-api"),
+		health: func(context.Context) error {
+			probes++
+			if probes < 3 {
+				return errors.New("not ready")
+			}
+			return nil
+		},
+	}
+	never := &healthyMockService{
+		mockService: newMockService("never", nil, "never-api"),
+		health: func(context.Context) error {
+			return errors.New("not ready")
+		},
+	}
+
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(), slow, never)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, c.Setup(ctx))
+
+	err = c.Start(ctx)
+	require.ErrorContains(t, err, "service never did not become ready: not ready")
+
+	status := c.ServiceStatus()
+	require.True(t, status["slow"].Running)
+	require.Equal(t, 3, probes)
+	require.True(t, status["slow"].Health.Healthy)
+	require.Len(t, status["slow"].Health.History, 3)
+	require.Equal(t, "slow/slow-api", status["slow"].ProvidesEndpoints["slow-api"].String())
+
+	require.False(t, status["never"].Running)
+	require.Nil(t, status["never"].Health)
+	require.Empty(t, status["never"].ProvidesEndpoints)
+}
+
+// crashingMockService is a mockService that implements FailureNotifier.
+type crashingMockService struct {
+	*mockService
+	starts int
+	failed chan error
+}
+
+func (s *crashingMockService) Start(ctx context.Context, dir string, genesis *types.GenesisDoc, inputs Endpoints) (Endpoints, error) {
+	s.starts++
+	s.failed = make(chan error, 1)
+	return s.mockService.Start(ctx, dir, genesis, inputs)
+}
+
+func (s *crashingMockService) Failed() <-chan error { return s.failed }
+
+func TestStopAfterProviderRestart(t *testing.T) {
+	base := &crashingMockService{mockService: newMockService("base", nil, "api")}
+	dep := newMockService("dep", []string{"api"})
+	var order []string
+	base.onStop = func(context.Context) error {
+		order = append(order, "base")
+		return nil
+	}
+	dep.onStop = func(context.Context) error {
+		order = append(order, "dep")
+		return nil
+	}
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(), base, dep)
+	require.NoError(t, err)
+	c.WithRestartPolicy(RestartPolicy{
+		MaxRestarts:      1,
+		InitialBackoff:   10 * time.Millisecond,
+		MaxBackoff:       10 * time.Millisecond,
+		FailureThreshold: 1,
+	})
+
+	ctx := context.Background()
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Start(ctx))
+
+	c.opLock.Lock()
+	base.failed <- errors.New("crashed")
+	c.opLock.Unlock()
+	require.Eventually(t, func() bool {
+		status := c.ServiceStatus()["base"]
+		return status.Running && status.Restarts == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// the restarted provider is still stopped after the service that
+	// depends on it
+	c.opLock.Lock()
+	order = nil
+	c.opLock.Unlock()
+	require.NoError(t, c.Stop(ctx))
+	require.Equal(t, []string{"dep", "base"}, order)
+	c.lock.RLock()
+	require.Empty(t, c.startOrder)
+	c.lock.RUnlock()
+}
+
+func TestRestartCrashedService(t *testing.T) {
+	crashing := &crashingMockService{mockService: newMockService("crashing", nil, "api")}
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(), crashing)
+	require.NoError(t, err)
+	c.WithRestartPolicy(RestartPolicy{
+		MaxRestarts:      1,
+		InitialBackoff:   10 * time.Millisecond,
+		MaxBackoff:       10 * time.Millisecond,
+		FailureThreshold: 1,
+	})
+
+	ctx := context.Background()
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Start(ctx))
+
+	c.opLock.Lock()
+	crashing.failed <- errors.New("crashed")
+	c.opLock.Unlock()
+	require.Eventually(t, func() bool {
+		status := c.ServiceStatus()["crashing"]
+		return status.Running && status.Restarts == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, "service crashing failed: crashed", c.ServiceStatus()["crashing"].LastError)
+
+	// the second crash exceeds the maximum number of restarts
+	c.opLock.Lock()
+	crashing.failed <- errors.New("crashed again")
+	c.opLock.Unlock()
+	require.Eventually(t, func() bool {
+		return c.ServiceStatus()["crashing"].Failed
+	}, time.Second, 10*time.Millisecond)
+	status := c.ServiceStatus()["crashing"]
+	require.False(t, status.Running)
+	require.Empty(t, status.ProvidesEndpoints)
+	require.Equal(t, 2, crashing.starts)
+
+	// manually starting the service resets the restart count
+	require.NoError(t, c.StartService(ctx, "crashing"))
+	status = c.ServiceStatus()["crashing"]
+	require.False(t, status.Failed)
+	require.Zero(t, status.Restarts)
+}
+
+func TestCrashedServiceStopTimeout(t *testing.T) {
+	crashing := &crashingMockService{mockService: newMockService("crashing", nil, "api")}
+	hung := make(chan struct{})
+	defer close(hung)
+	crashing.onStop = func(context.Context) error {
+		<-hung
+		return nil
+	}
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(), crashing)
+	require.NoError(t, err)
+	c.WithRestartPolicy(RestartPolicy{FailureThreshold: 1})
+	c.WithTimeouts(Timeouts{Stop: 50 * time.Millisecond})
+
+	ctx := context.Background()
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Start(ctx))
+	c.opLock.Lock()
+	crashing.failed <- errors.New("crashed")
+	c.opLock.Unlock()
+
+	// a crashed service that doesn't stop doesn't block other operations
+	require.Eventually(t, func() bool {
+		return c.ServiceStatus()["crashing"].Failed
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, c.Stop(ctx))
+}
+
+func TestStatusDuringStart(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slow := newMockService("slow", []string{"rpc"}, "slow-api")
+	slow.onStart = func(context.Context) error {
+		close(started)
+		<-release
+		return nil
+	}
+
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(),
+		newMockService("consensus", nil, "rpc"), slow,
+	)
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.StartService(ctx, "consensus"))
+
+	startErr := make(chan error, 1)
+	go func() { startErr <- c.StartService(ctx, "slow") }()
+	<-started
+
+	// reading the status must not wait for the slow service to start
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		require.True(t, c.IsServiceRunning("consensus"))
+		require.False(t, c.IsServiceRunning("slow"))
+		require.True(t, c.ServiceStatus()["consensus"].Running)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("status was blocked by a starting service")
+	}
+
+	// operations are serialized: stopping consensus waits until slow has
+	// started and is then refused because slow depends on it
+	stopErr := make(chan error, 1)
+	go func() { stopErr <- c.StopService(ctx, "consensus") }()
+	close(release)
+	require.NoError(t, <-startErr)
+	require.ErrorContains(t, <-stopErr, "cannot stop service 'consensus'")
+	require.True(t, c.IsServiceRunning("slow"))
+	require.NoError(t, c.Stop(ctx))
+}
+
+func TestEvents(t *testing.T) {
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(),
+		newMockService("consensus", nil, "rpc"),
+		newMockService("light", []string{"rpc"}),
+	)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, c.Setup(ctx))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.serveEvents(ctx, w, r)
+	}))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "?service=light")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := c.Subscribe(ctx)
+	require.NoError(t, c.Start(ctx))
+	require.NoError(t, c.StopService(ctx, "light"))
+
+	expected := []Event{
+		{Type: EventServiceStarting, Service: "consensus"},
+		{Type: EventServiceStarted, Service: "consensus", Endpoints: Endpoints{"rpc": mockEndpoint("consensus", "rpc")}},
+		{Type: EventEndpointsChanged, Endpoints: Endpoints{"rpc": mockEndpoint("consensus", "rpc")}},
+		{Type: EventServiceStarting, Service: "light"},
+		{Type: EventServiceStarted, Service: "light", Endpoints: Endpoints{}},
+		{Type: EventEndpointsChanged, Endpoints: Endpoints{"rpc": mockEndpoint("consensus", "rpc")}},
+		{Type: EventServiceStopping, Service: "light"},
+		{Type: EventServiceStopped, Service: "light"},
+		{Type: EventEndpointsChanged, Endpoints: Endpoints{"rpc": mockEndpoint("consensus", "rpc")}},
+	}
+	for _, want := range expected {
+		event := <-events
+		event.Time = time.Time{}
+		require.Equal(t, want, event)
+	}
+
+	// the event stream only includes events for the light service
+	reader := bufio.NewReader(resp.Body)
+	for _, eventType := range []EventType{EventServiceStarting, EventServiceStarted, EventServiceStopping, EventServiceStopped} {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, "event: "+string(eventType)+"\n", line)
+		line, err = reader.ReadString('\n')
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(line, "data: {"))
+		_, err = reader.ReadString('\n')
+		require.NoError(t, err)
+	}
+}
+
+func TestServiceLogs(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(dir, genesis.NewDefaultGenesis(), newMockService("consensus", nil, "rpc"))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Start(ctx))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.serveLogs(ctx, w, r, "consensus")
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?tail=1")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Contains(t, string(body), "apollo: service started on endpoints: rpc: consensus/rpc")
+	require.Equal(t, 1, strings.Count(string(body), "\n"))
+
+	// follow the log while the service is stopped
+	resp, err = http.Get(server.URL + "?tail=0&follow=true")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.NoError(t, c.StopService(ctx, "consensus"))
+	reader := bufio.NewReader(resp.Body)
+	for _, expected := range []string{"service stopping", "service stopped"} {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		require.Contains(t, line, expected)
+	}
+
+	logs, err := os.ReadFile(filepath.Join(dir, "consensus", LogFileName))
+	require.NoError(t, err)
+	require.Contains(t, string(logs), "service starting")
+	require.Contains(t, string(logs), "service stopped")
+}
+
+func TestLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LogFileName)
+	sink, err := newLogSink(path)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	line := []byte(strings.Repeat("a", 1<<20-1) + "\n")
+	for i := 0; i < 4*maxLogSize/len(line)+1; i++ {
+		_, err := sink.Write(line)
+		require.NoError(t, err)
+	}
+	for i := 1; i <= maxLogBackups; i++ {
+		require.FileExists(t, fmt.Sprintf("%s.%d", path, i))
+	}
+	require.NoFileExists(t, fmt.Sprintf("%s.%d", path, maxLogBackups+1))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.LessOrEqual(t, info.Size(), int64(maxLogSize))
+}
+
+func TestServeFixedPort(t *testing.T) {
+	port, err := freePort()
+	require.NoError(t, err)
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(), newMockService("consensus", nil, "rpc"))
+	require.NoError(t, err)
+	cfg := DefaultServerConfig()
+	cfg.ListenAddress = fmt.Sprintf("127.0.0.1:%d", port)
+	cfg.FixedPort = true
+	c.WithServerConfig(cfg).WithPortAllocator(NewPortAllocator().WithOffset(100))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, c.Setup(ctx))
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Serve(ctx) }()
+
+	require.Eventually(t, func() bool { return c.PanelAddress() != "" }, time.Second, 10*time.Millisecond)
+	require.Equal(t, fmt.Sprintf("http://127.0.0.1:%d", port), c.PanelAddress())
+	cancel()
+	require.ErrorIs(t, <-errCh, context.Canceled)
+	require.NoError(t, c.Close())
+}
+
+func TestServeWritesPanelAddress(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(dir, genesis.NewDefaultGenesis(), newMockService("consensus", nil, "rpc"))
+	require.NoError(t, err)
+	cfg := DefaultServerConfig()
+	cfg.ListenAddress = "127.0.0.1:0"
+	c.WithServerConfig(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, c.Setup(ctx))
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Serve(ctx) }()
+
+	require.Eventually(t, func() bool { return c.PanelAddress() != "" }, time.Second, 10*time.Millisecond)
+	address, err := ReadPanelAddress(dir)
+	require.NoError(t, err)
+	require.Equal(t, c.PanelAddress(), address)
+	require.True(t, strings.HasPrefix(address, "http://127.0.0.1:"))
+
+	resp, err := http.Get(address + "/status")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cancel()
+	require.ErrorIs(t, <-errCh, context.Canceled)
+	_, err = ReadPanelAddress(dir)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestPortAllocator(t *testing.T) {
+	ports := NewPortAllocator().WithOffset(100)
+	port, err := ports.Port(8080)
+	require.NoError(t, err)
+	require.Equal(t, 8180, port)
+	// a port is never handed out twice
+	port, err = ports.Port(8080)
+	require.NoError(t, err)
+	require.Equal(t, 8181, port)
+
+	address, err := ports.Address("tcp://127.0.0.1:26657")
+	require.NoError(t, err)
+	require.Equal(t, "tcp://127.0.0.1:26757", address)
+	address, err = ports.Address("localhost:1095")
+	require.NoError(t, err)
+	require.Equal(t, "localhost:1195", address)
+	_, err = ports.Address("localhost")
+	require.Error(t, err)
+
+	random := NewPortAllocator().WithRandomPorts()
+	first, err := random.Port(8080)
+	require.NoError(t, err)
+	second, err := random.Port(8080)
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+}
+
+// portService is a mockService that shifts its port by the offset of the
+// allocator every time it is assigned its ports.
+type portService struct {
+	*mockService
+	port int
+}
+
+func (s *portService) AssignPorts(ports *PortAllocator) error {
+	port, err := ports.Port(s.port)
+	s.port = port
+	return err
+}
+
+func TestAssignPortsOnce(t *testing.T) {
+	service := &portService{mockService: newMockService("consensus", nil, "rpc"), port: 26657}
+	c, err := New(t.TempDir(), genesis.NewDefaultGenesis(), service)
+	require.NoError(t, err)
+	c.WithPortAllocator(NewPortAllocator().WithOffset(100))
+
+	ctx := context.Background()
+	require.NoError(t, c.Setup(ctx))
+	require.NoError(t, c.Setup(ctx))
+	require.Equal(t, 26757, service.port)
+	require.NoError(t, c.Close())
+}
+
+func TestEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		endpoint Endpoint
+	}{
+		{"tcp://127.0.0.1:26657", Endpoint{Scheme: "tcp", Host: "127.0.0.1", Port: 26657}},
+		{"http://localhost:26658/docs", Endpoint{Scheme: "http", Host: "localhost", Port: 26658, Path: "/docs"}},
+		{"https://docs.cosmos.network/api", Endpoint{Scheme: "https", Host: "docs.cosmos.network", Path: "/api"}},
+		{"0.0.0.0:9090", Endpoint{Host: "0.0.0.0", Port: 9090}},
+		{"[::1]:9090", Endpoint{Host: "::1", Port: 9090}},
+		{"/ip4/127.0.0.1/tcp/2121/p2p/12D3KooWNaJ1y1Yio3fFJEXCZyd1Cat3jmrPdgkYCrHfKD3Ce21p", Endpoint{
+			Scheme:   SchemeP2P,
+			Host:     "127.0.0.1",
+			Port:     2121,
+			Metadata: map[string]string{PeerIDKey: "12D3KooWNaJ1y1Yio3fFJEXCZyd1Cat3jmrPdgkYCrHfKD3Ce21p"},
+		}},
+	} {
+		endpoint, err := ParseEndpoint(tc.input)
+		require.NoError(t, err)
+		require.Equal(t, tc.endpoint, endpoint)
+		require.Equal(t, tc.input, endpoint.String())
+
+		data, err := json.Marshal(endpoint)
+		require.NoError(t, err)
+		var decoded Endpoint
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		require.Equal(t, endpoint, decoded)
+	}
+
+	endpoint := NewEndpoint("", "localhost", 9090)
+	require.Equal(t, "localhost:9090", endpoint.HostPort())
+	require.Equal(t, "http://localhost:9090", endpoint.URL("http"))
+	require.Equal(t, "/dns/localhost/tcp/9090", endpoint.Multiaddr())
+
+	_, err := ParseEndpoint("localhost:rpc")
+	require.Error(t, err)
+}
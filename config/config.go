@@ -0,0 +1,287 @@
+// Package config loads declarative definitions of Apollo networks from TOML
+// files. A definition lists the services to run together with their
+// configuration and describes the genesis of the network:
+//
+//	[genesis]
+//	immediate_proposals = true
+//
+//	[genesis.blob_params]
+//	gov_max_square_size = 128
+//
+//	[[genesis.accounts]]
+//	address = "celestia1..."
+//	balance = "1000000000utia"
+//
+//	[services.consensus-node]
+//	timeout_commit = "1s"
+//
+//	[services.faucet]
+//	amount = 10000000
+//
+//	[services.bridge-node]
+//	start_timeout = "10m"
+//
+//	[services.light-node.RPC]
+//	Port = "26658"
+//
+//	[services.my-rollup]
+//	type = "rollup"
+//
+//	[services.sequencer]
+//	type = "exec"
+//	command = "sequencer"
+//	args = ["--da", "{{.bridge-rpc}}"]
+//	endpoints_needed = ["bridge-rpc"]
+//
+//	[services.indexer]
+//	type = "plugin"
+//	command = "indexer-plugin"
+//
+// Every table under services runs a service of the type set by its type
+// key, which defaults to the name of the table. Each type of service is
+// registered with apollo.RegisterServiceType and decodes its own table: the
+// faucet takes its Config, while the bridge and light nodes take the same
+// configuration as celestia-node's config.toml. Any table may also set
+// setup_timeout, start_timeout and stop_timeout to override how long the
+// service is given for each step. If no services are listed, the
+// DefaultServices are run with their default configuration.
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/celestiaorg/apollo"
+	// register the exec and plugin service types so that processes and
+	// plugins can be run
+	_ "github.com/celestiaorg/apollo/exec"
+	"github.com/celestiaorg/apollo/faucet"
+	"github.com/celestiaorg/apollo/genesis"
+	"github.com/celestiaorg/apollo/node/bridge"
+	"github.com/celestiaorg/apollo/node/consensus"
+	"github.com/celestiaorg/apollo/node/light"
+	_ "github.com/celestiaorg/apollo/plugin"
+	blobtypes "github.com/celestiaorg/celestia-app/x/blob/types"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// Network is the definition of a network.
+type Network struct {
+	Genesis  Genesis                   `toml:"genesis"`
+	Services map[string]toml.Primitive `toml:"services"`
+
+	metadata toml.MetaData
+	selected []string
+}
+
+// DefaultServices are the services that are run if a definition doesn't
+// list any.
+var DefaultServices = []string{
+	consensus.ConsensusServiceName,
+	faucet.FaucetServiceName,
+	bridge.BridgeServiceName,
+	light.LightServiceName,
+}
+
+// Genesis describes changes to the default genesis of the network.
+type Genesis struct {
+	// Accounts are funded in the genesis.
+	Accounts []Account `toml:"accounts"`
+	// BlobParams replaces the parameters of the blob module. Parameters
+	// that aren't set keep their default value.
+	BlobParams *BlobParams `toml:"blob_params"`
+	// ImmediateProposals lowers the thresholds of governance proposals so
+	// that they pass straight away.
+	ImmediateProposals bool `toml:"immediate_proposals"`
+}
+
+type Account struct {
+	Address string `toml:"address"`
+	// Balance is the amount and denomination, for example "1000utia".
+	Balance string `toml:"balance"`
+}
+
+type BlobParams struct {
+	GasPerBlobByte   uint32 `toml:"gas_per_blob_byte"`
+	GovMaxSquareSize uint64 `toml:"gov_max_square_size"`
+}
+
+// Default returns a network of all built-in services with their default
+// configuration.
+func Default() *Network {
+	return &Network{}
+}
+
+// Load reads the definition of a network from a TOML file.
+func Load(path string) (*Network, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading network definition: %w", err)
+	}
+	network, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return network, nil
+}
+
+// Parse reads the definition of a network from TOML.
+func Parse(data []byte) (*Network, error) {
+	var network Network
+	md, err := toml.NewDecoder(bytes.NewReader(data)).Decode(&network)
+	if err != nil {
+		return nil, fmt.Errorf("parsing network definition: %w", err)
+	}
+	network.metadata = md
+	// service tables are only decoded once the services are created
+	if err := network.checkUndecoded(func(key toml.Key) bool { return key[0] != "services" }); err != nil {
+		return nil, err
+	}
+	return &network, nil
+}
+
+// checkUndecoded returns an error listing the keys that were not decoded,
+// which are most likely misspelled, among those matching the filter.
+func (n *Network) checkUndecoded(filter func(toml.Key) bool) error {
+	var keys []string
+	for _, key := range n.metadata.Undecoded() {
+		if filter(key) {
+			keys = append(keys, key.String())
+		}
+	}
+	if len(keys) > 0 {
+		return fmt.Errorf("unknown keys in network definition: %s", strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// NewGenesis returns the default genesis with the changes of the
+// definition applied.
+func (n *Network) NewGenesis() (*genesis.Genesis, error) {
+	gen := genesis.NewDefaultGenesis()
+	cdc := apollo.Codec().Codec
+	for _, account := range n.Genesis.Accounts {
+		address, err := sdk.AccAddressFromBech32(account.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid genesis account address %q: %w", account.Address, err)
+		}
+		balance, err := sdk.ParseCoinNormalized(account.Balance)
+		if err != nil {
+			return nil, fmt.Errorf("invalid balance %q for genesis account %s: %w", account.Balance, account.Address, err)
+		}
+		gen = gen.WithModifiers(genesis.FundAccounts(cdc, []sdk.AccAddress{address}, balance))
+	}
+	if n.Genesis.BlobParams != nil {
+		params := blobtypes.DefaultParams()
+		if n.Genesis.BlobParams.GasPerBlobByte != 0 {
+			params.GasPerBlobByte = n.Genesis.BlobParams.GasPerBlobByte
+		}
+		if n.Genesis.BlobParams.GovMaxSquareSize != 0 {
+			params.GovMaxSquareSize = n.Genesis.BlobParams.GovMaxSquareSize
+		}
+		if err := params.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid blob params: %w", err)
+		}
+		gen = gen.WithModifiers(genesis.SetBlobParams(cdc, params))
+	}
+	if n.Genesis.ImmediateProposals {
+		gen = gen.WithModifiers(genesis.ImmediateProposals(cdc))
+	}
+	return gen, nil
+}
+
+// NewServices creates the services of the network from the registered
+// service types, each with its configuration decoded from the definition.
+func (n *Network) NewServices() ([]apollo.Service, error) {
+	names := n.selected
+	if names == nil {
+		for name := range n.Services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		names = DefaultServices
+	}
+
+	services := make([]apollo.Service, 0, len(names))
+	for _, name := range names {
+		service, err := n.newService(name)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		services = append(services, service)
+	}
+	// the tables of services that weren't selected are never decoded
+	err := n.checkUndecoded(func(key toml.Key) bool {
+		return key[0] != "services" || len(key) < 2 || slices.Contains(names, key[1])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// WithServices runs only the named services instead of those listed in the
+// definition. Services without a table in the definition use their default
+// configuration.
+func (n *Network) WithServices(names ...string) *Network {
+	n.selected = names
+	return n
+}
+
+// newService creates a service of the type set in its table, which
+// defaults to the name of the service.
+func (n *Network) newService(name string) (apollo.Service, error) {
+	primitive, ok := n.Services[name]
+	if !ok {
+		return apollo.NewServiceOfType(name, name, func(any) error { return nil })
+	}
+	var header serviceHeader
+	if err := n.metadata.PrimitiveDecode(primitive, &header); err != nil {
+		return nil, err
+	}
+	serviceType := header.Type
+	if serviceType == "" {
+		serviceType = name
+	}
+	return apollo.NewServiceOfType(serviceType, name, func(v any) error {
+		return n.metadata.PrimitiveDecode(primitive, v)
+	})
+}
+
+// serviceHeader holds the keys of a service table that are read by the
+// network rather than by the service itself.
+type serviceHeader struct {
+	Type         string        `toml:"type"`
+	SetupTimeout time.Duration `toml:"setup_timeout"`
+	StartTimeout time.Duration `toml:"start_timeout"`
+	StopTimeout  time.Duration `toml:"stop_timeout"`
+}
+
+// Timeouts returns the timeouts of the services whose tables set any.
+// Timeouts that aren't set are zero.
+func (n *Network) Timeouts() (map[string]apollo.Timeouts, error) {
+	timeouts := make(map[string]apollo.Timeouts)
+	for name, primitive := range n.Services {
+		var header serviceHeader
+		if err := n.metadata.PrimitiveDecode(primitive, &header); err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		serviceTimeouts := apollo.Timeouts{
+			Setup: header.SetupTimeout,
+			Start: header.StartTimeout,
+			Stop:  header.StopTimeout,
+		}
+		if serviceTimeouts != (apollo.Timeouts{}) {
+			timeouts[name] = serviceTimeouts
+		}
+	}
+	return timeouts, nil
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/celestiaorg/apollo"
+	"github.com/celestiaorg/apollo/faucet"
+	"github.com/celestiaorg/apollo/node/bridge"
+	"github.com/celestiaorg/apollo/node/consensus"
+	"github.com/celestiaorg/apollo/node/light"
+	"github.com/stretchr/testify/require"
+)
+
+const definition = `
+[genesis]
+immediate_proposals = true
+
+[genesis.blob_params]
+gov_max_square_size = 128
+
+[[genesis.accounts]]
+address = "celestia1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqzf30as"
+balance = "1000utia"
+
+[services.consensus-node]
+timeout_commit = "2s"
+
+[services.faucet]
+amount = 42
+
+[services.bridge-node.RPC]
+Port = "36000"
+`
+
+func TestParse(t *testing.T) {
+	network, err := Parse([]byte(definition))
+	require.NoError(t, err)
+	_, err = network.NewGenesis()
+	require.NoError(t, err)
+
+	services, err := network.NewServices()
+	require.NoError(t, err)
+	names := make([]string, len(services))
+	for i, service := range services {
+		names[i] = service.Name()
+	}
+	require.Equal(t, []string{bridge.BridgeServiceName, consensus.ConsensusServiceName, faucet.FaucetServiceName}, names)
+}
+
+func TestTimeouts(t *testing.T) {
+	network, err := Parse([]byte(`
+[services.consensus-node]
+timeout_commit = "2s"
+start_timeout = "10m"
+
+[services.faucet]
+setup_timeout = "30s"
+stop_timeout = "5s"
+
+[services.bridge-node]
+`))
+	require.NoError(t, err)
+	_, err = network.NewServices()
+	require.NoError(t, err)
+
+	timeouts, err := network.Timeouts()
+	require.NoError(t, err)
+	require.Equal(t, map[string]apollo.Timeouts{
+		consensus.ConsensusServiceName: {Start: 10 * time.Minute},
+		faucet.FaucetServiceName:       {Setup: 30 * time.Second, Stop: 5 * time.Second},
+	}, timeouts)
+}
+
+func TestConsensusOverrides(t *testing.T) {
+	var overrides consensus.ConfigOverrides
+	_, err := toml.Decode("timeout_commit = \"2s\"\ngrpc_address = \"127.0.0.1:9999\"", &overrides)
+	require.NoError(t, err)
+	cfg := consensus.DefaultConfig()
+	overrides.Apply(cfg)
+	require.Equal(t, 2*time.Second, cfg.TmConfig.Consensus.TimeoutCommit)
+	require.Equal(t, "127.0.0.1:9999", cfg.AppConfig.GRPC.Address)
+	require.NotEmpty(t, cfg.TmConfig.RPC.ListenAddress)
+}
+
+func TestDefaultServices(t *testing.T) {
+	services, err := Default().NewServices()
+	require.NoError(t, err)
+	require.Len(t, services, 4)
+	require.Equal(t, light.LightServiceName, services[3].Name())
+}
+
+func TestUnknownKeys(t *testing.T) {
+	_, err := Parse([]byte("[genesis]\nimmediate_proposal = true\n"))
+	require.ErrorContains(t, err, "genesis.immediate_proposal")
+
+	network, err := Parse([]byte("[services.faucet]\namount = 1\nammount = 2\n"))
+	require.NoError(t, err)
+	_, err = network.NewServices()
+	require.ErrorContains(t, err, "services.faucet.ammount")
+
+	network, err = Parse([]byte("[services.rollup]\n"))
+	require.NoError(t, err)
+	_, err = network.NewServices()
+	require.ErrorContains(t, err, `service rollup: unknown service type "rollup"`)
+}
+
+type rollupConfig struct {
+	DAEndpoint string `toml:"da_endpoint"`
+	BlockTime  string `toml:"block_time"`
+}
+
+type rollup struct {
+	apollo.Service
+	name   string
+	config rollupConfig
+}
+
+func (r *rollup) Name() string { return r.name }
+
+func TestRegisteredServiceType(t *testing.T) {
+	apollo.RegisterServiceType("test-rollup", func(name string, decode func(any) error) (apollo.Service, error) {
+		cfg := rollupConfig{BlockTime: "1s"}
+		if err := decode(&cfg); err != nil {
+			return nil, err
+		}
+		return &rollup{name: name, config: cfg}, nil
+	})
+	require.Contains(t, apollo.ServiceTypes(), "test-rollup")
+
+	network, err := Parse([]byte("[services.my-rollup]\ntype = \"test-rollup\"\nda_endpoint = \"http://localhost:26658\"\n"))
+	require.NoError(t, err)
+	services, err := network.WithServices("consensus-node", "my-rollup").NewServices()
+	require.NoError(t, err)
+	require.Len(t, services, 2)
+	require.Equal(t, consensus.ConsensusServiceName, services[0].Name())
+	r := services[1].(*rollup)
+	require.Equal(t, rollupConfig{DAEndpoint: "http://localhost:26658", BlockTime: "1s"}, r.config)
+}
+
+func TestSelectedServices(t *testing.T) {
+	network, err := Parse([]byte(definition))
+	require.NoError(t, err)
+	services, err := network.WithServices(consensus.ConsensusServiceName, light.LightServiceName).NewServices()
+	require.NoError(t, err)
+	require.Len(t, services, 2)
+
+	// unknown keys are still reported for the selected services
+	network, err = Parse([]byte("[services.faucet]\nammount = 2\n\n[services.bridge-node]\nfoo = 1\n"))
+	require.NoError(t, err)
+	_, err = network.WithServices(faucet.FaucetServiceName).NewServices()
+	require.ErrorContains(t, err, "services.faucet.ammount")
+	require.NotContains(t, err.Error(), "services.bridge-node.foo")
+}
+
+func TestExecService(t *testing.T) {
+	network, err := Parse([]byte(`
+[services.sequencer]
+type = "exec"
+command = "sequencer"
+args = ["--da", "{{.bridge-rpc}}"]
+endpoints_needed = ["bridge-rpc"]
+endpoints = { sequencer-rpc = "http://localhost:{{.port.rpc}}" }
+ports = { rpc = 26800 }
+stop_timeout = "5s"
+`))
+	require.NoError(t, err)
+	services, err := network.NewServices()
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	require.Equal(t, "sequencer", services[0].Name())
+	require.Equal(t, []string{"bridge-rpc"}, services[0].EndpointsNeeded())
+	require.Equal(t, []string{"sequencer-rpc"}, services[0].EndpointsProvided())
+
+	network, err = Parse([]byte("[services.sequencer]\ntype = \"exec\"\n"))
+	require.NoError(t, err)
+	_, err = network.NewServices()
+	require.ErrorContains(t, err, "service sequencer: command must be set")
+}
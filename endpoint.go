@@ -0,0 +1,183 @@
+package apollo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// SchemeP2P is the scheme of endpoints that are libp2p peers. They are
+	// rendered as multiaddrs.
+	SchemeP2P = "p2p"
+	// PeerIDKey is the metadata key of the peer ID of a libp2p endpoint.
+	PeerIDKey = "peer-id"
+)
+
+// Endpoint is an address that a service provides to other services.
+type Endpoint struct {
+	// Scheme is the protocol of the endpoint, such as "http" or "tcp". It
+	// is empty for plain host and port addresses, such as those of gRPC
+	// servers.
+	Scheme string
+	Host   string
+	// Port is zero if the endpoint has no port.
+	Port int
+	// Path includes the leading slash.
+	Path string
+	// Metadata holds any further information about the endpoint, such as
+	// the peer ID of a libp2p endpoint. It is not part of the string form.
+	Metadata map[string]string
+}
+
+// NewEndpoint creates an endpoint from a scheme, host and port.
+func NewEndpoint(scheme, host string, port int) Endpoint {
+	return Endpoint{Scheme: scheme, Host: host, Port: port}
+}
+
+// ParseEndpoint parses the string form of an endpoint: a URL such as
+// "http://localhost:26658", a host and port such as "127.0.0.1:9090", or a
+// multiaddr such as "/ip4/127.0.0.1/tcp/2121/p2p/12D3KooW...".
+func ParseEndpoint(s string) (Endpoint, error) {
+	switch {
+	case strings.HasPrefix(s, "/"):
+		return parseMultiaddr(s)
+	case strings.Contains(s, "://"):
+		u, err := url.Parse(s)
+		if err != nil {
+			return Endpoint{}, fmt.Errorf("invalid endpoint %q: %w", s, err)
+		}
+		endpoint := Endpoint{Scheme: u.Scheme, Host: u.Hostname(), Path: u.Path}
+		if port := u.Port(); port != "" {
+			if endpoint.Port, err = strconv.Atoi(port); err != nil {
+				return Endpoint{}, fmt.Errorf("invalid port in endpoint %q: %w", s, err)
+			}
+		}
+		return endpoint, nil
+	default:
+		hostPort, path := s, ""
+		if i := strings.Index(s, "/"); i >= 0 {
+			hostPort, path = s[:i], s[i:]
+		}
+		host, portStr, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			// a host without a port
+			return Endpoint{Host: hostPort, Path: path}, nil
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return Endpoint{}, fmt.Errorf("invalid port in endpoint %q: %w", s, err)
+		}
+		return Endpoint{Host: host, Port: port, Path: path}, nil
+	}
+}
+
+// MustParseEndpoint is like ParseEndpoint but panics if the endpoint is
+// invalid. It is meant for endpoints that are known to be valid.
+func MustParseEndpoint(s string) Endpoint {
+	endpoint, err := ParseEndpoint(s)
+	if err != nil {
+		panic(err)
+	}
+	return endpoint
+}
+
+func parseMultiaddr(s string) (Endpoint, error) {
+	addr, err := ma.NewMultiaddr(s)
+	if err != nil {
+		return Endpoint{}, fmt.Errorf("invalid endpoint %q: %w", s, err)
+	}
+	endpoint := Endpoint{Scheme: SchemeP2P}
+	ma.ForEach(addr, func(c ma.Component) bool {
+		switch c.Protocol().Code {
+		case ma.P_IP4, ma.P_IP6, ma.P_DNS, ma.P_DNS4, ma.P_DNS6:
+			endpoint.Host = c.Value()
+		case ma.P_TCP:
+			endpoint.Port, err = strconv.Atoi(c.Value())
+		case ma.P_P2P:
+			endpoint.Metadata = map[string]string{PeerIDKey: c.Value()}
+		}
+		return err == nil
+	})
+	if err != nil {
+		return Endpoint{}, fmt.Errorf("invalid port in endpoint %q: %w", s, err)
+	}
+	return endpoint, nil
+}
+
+// HostPort returns the host and port of the endpoint, for example
+// "localhost:26658".
+func (e Endpoint) HostPort() string {
+	if e.Port == 0 {
+		return e.Host
+	}
+	return net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+}
+
+// URL returns the endpoint as a URL. Endpoints without a scheme are given
+// the default scheme, for example "http".
+func (e Endpoint) URL(defaultScheme string) string {
+	scheme := e.Scheme
+	if scheme == "" {
+		scheme = defaultScheme
+	}
+	return scheme + "://" + e.HostPort() + e.Path
+}
+
+// Multiaddr returns the endpoint as a TCP multiaddr, including the peer ID
+// if the endpoint has one.
+func (e Endpoint) Multiaddr() string {
+	var b strings.Builder
+	if ip := net.ParseIP(e.Host); ip == nil {
+		b.WriteString("/dns/" + e.Host)
+	} else if ip.To4() != nil {
+		b.WriteString("/ip4/" + ip.String())
+	} else {
+		b.WriteString("/ip6/" + ip.String())
+	}
+	if e.Port != 0 {
+		b.WriteString("/tcp/" + strconv.Itoa(e.Port))
+	}
+	if id := e.Metadata[PeerIDKey]; id != "" {
+		b.WriteString("/p2p/" + id)
+	}
+	return b.String()
+}
+
+// String returns the endpoint as it is shown in /status and events: libp2p
+// endpoints as multiaddrs, endpoints with a scheme as URLs and all others as
+// host and port.
+func (e Endpoint) String() string {
+	switch e.Scheme {
+	case SchemeP2P:
+		return e.Multiaddr()
+	case "":
+		return e.HostPort() + e.Path
+	default:
+		return e.URL("")
+	}
+}
+
+// MarshalJSON encodes the endpoint in its string form.
+func (e Endpoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.String())
+}
+
+// UnmarshalJSON decodes an endpoint from its string form.
+func (e *Endpoint) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	endpoint, err := ParseEndpoint(s)
+	if err != nil {
+		return err
+	}
+	*e = endpoint
+	return nil
+}
@@ -0,0 +1,161 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventBufferSize is the number of events buffered for each subscriber.
+// Events are dropped for subscribers that fall further behind.
+const eventBufferSize = 64
+
+type EventType string
+
+const (
+	EventServiceStarting  EventType = "starting"
+	EventServiceStarted   EventType = "started"
+	EventServiceStopping  EventType = "stopping"
+	EventServiceStopped   EventType = "stopped"
+	EventServiceFailed    EventType = "failed"
+	EventHealthChanged    EventType = "health_changed"
+	EventEndpointsChanged EventType = "endpoints_changed"
+)
+
+// Event describes a change in the lifecycle of a service or the network.
+// Endpoints is set for started events, with the endpoints the service
+// provides, and for endpoints changed events, with all active endpoints.
+type Event struct {
+	Type      EventType `json:"type"`
+	Service   string    `json:"service,omitempty"`
+	Endpoints Endpoints `json:"endpoints,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// eventBus fans out events to all subscribers without ever blocking the
+// publisher.
+type eventBus struct {
+	lock        sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[chan Event]struct{})}
+}
+
+func (b *eventBus) publish(event Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (b *eventBus) subscribe(ctx context.Context) <-chan Event {
+	ch := make(chan Event, eventBufferSize)
+	b.lock.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.lock.Lock()
+		delete(b.subscribers, ch)
+		b.lock.Unlock()
+		close(ch)
+	}()
+	return ch
+}
+
+// Subscribe returns a channel of all lifecycle events emitted by the
+// Conductor from now on. The channel is closed once the context is
+// cancelled. Events are dropped if the subscriber doesn't keep up.
+func (c *Conductor) Subscribe(ctx context.Context) <-chan Event {
+	return c.events.subscribe(ctx)
+}
+
+// emit publishes an event about a service to all subscribers.
+func (c *Conductor) emit(eventType EventType, name string, endpoints Endpoints, err error) {
+	event := Event{
+		Type:      eventType,
+		Service:   name,
+		Endpoints: endpoints,
+		Time:      time.Now(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	if name != "" {
+		switch {
+		case err != nil:
+			c.logService(name, "service %s: %s", eventType, event.Error)
+		case len(endpoints) > 0:
+			c.logService(name, "service %s on endpoints: %v", eventType, endpoints)
+		default:
+			c.logService(name, "service %s", eventType)
+		}
+	}
+	c.events.publish(event)
+}
+
+// emitEndpointsChanged publishes a snapshot of all active endpoints. The
+// caller must hold the lock.
+func (c *Conductor) emitEndpointsChanged() {
+	c.emit(EventEndpointsChanged, "", c.activeEndpoints.copy(), nil)
+}
+
+// serveEvents streams events to the client as Server-Sent Events. The
+// optional "service" and "type" query parameters filter the events that
+// are sent.
+func (c *Conductor) serveEvents(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	service := r.URL.Query().Get("service")
+	eventType := EventType(r.URL.Query().Get("type"))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-r.Context().Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	events := c.Subscribe(ctx)
+
+	disableWriteTimeout(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for event := range events {
+		if service != "" && event.Service != service {
+			continue
+		}
+		if eventType != "" && event.Type != eventType {
+			continue
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			c.logger.Printf("failed to marshal event: %s", err.Error())
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,408 @@
+// Package exec runs an arbitrary binary as an Apollo service. This allows
+// rollup nodes, sequencers, indexers and other processes to join a network
+// without writing a Go wrapper for each of them.
+//
+// The arguments, environment and working directory of the process are
+// templated: "{{.name}}" is replaced with the endpoint of that name that the
+// service needs, "{{.name.host}}" and "{{.name.port}}" with its host and
+// port, "{{.dir}}" with the service's directory and
+// "{{.port.name}}" with the port assigned in place of a default port of the
+// same name. The endpoints the service provides are listed in its
+// configuration and templated too. If a ReadyPattern is set, they are only
+// published once the process writes a line to its standard output that
+// matches it, and "{{.ready.name}}" is replaced with the named group of the
+// match, so that endpoints such as ports chosen by the process itself can be
+// read from its output.
+package exec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	osexec "os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/celestiaorg/apollo"
+	"github.com/celestiaorg/apollo/genesis"
+	"github.com/tendermint/tendermint/types"
+)
+
+var (
+	_ apollo.Service         = &Service{}
+	_ apollo.FailureNotifier = &Service{}
+	_ apollo.LogOutputSetter = &Service{}
+	_ apollo.PortAssigner    = &Service{}
+)
+
+// ServiceType is the type under which the service is registered, for use
+// in network definitions.
+const ServiceType = "exec"
+
+// DefaultStopTimeout is how long the process is given to exit after
+// SIGTERM before it is killed.
+const DefaultStopTimeout = 10 * time.Second
+
+func init() {
+	apollo.RegisterServiceType(ServiceType, func(name string, decode func(any) error) (apollo.Service, error) {
+		cfg := DefaultConfig()
+		if err := decode(cfg); err != nil {
+			return nil, err
+		}
+		return New(name, cfg)
+	})
+}
+
+type Config struct {
+	// Command is the binary to run, either a path or a name that is looked
+	// up in PATH.
+	Command string            `toml:"command"`
+	Args    []string          `toml:"args"`
+	Env     map[string]string `toml:"env"`
+	// WorkDir is the working directory of the process. It defaults to the
+	// service's directory.
+	WorkDir string `toml:"work_dir"`
+	// EndpointsNeeded are the endpoints of other services the process
+	// depends on. The service is started after the services providing them.
+	EndpointsNeeded []string `toml:"endpoints_needed"`
+	// Endpoints are the endpoints the service provides.
+	Endpoints map[string]string `toml:"endpoints"`
+	// ReadyPattern is a regular expression that is matched against every
+	// line the process writes to standard output. Start returns once a line
+	// matches and its named groups can be used in the endpoints. If it is
+	// empty, Start returns as soon as the process is running.
+	ReadyPattern string `toml:"ready_pattern"`
+	// Ports are the default ports the process listens on by name. Each is
+	// replaced by the port assigned by the Conductor.
+	Ports map[string]int `toml:"ports"`
+	// StopTimeout is how long the process is given to exit after SIGTERM
+	// before it is killed.
+	StopTimeout time.Duration `toml:"stop_timeout"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		StopTimeout: DefaultStopTimeout,
+	}
+}
+
+// Service runs a process as an Apollo service.
+type Service struct {
+	name         string
+	config       *Config
+	readyPattern *regexp.Regexp
+	logOutput    io.Writer
+
+	lock     sync.Mutex
+	cmd      *osexec.Cmd
+	failed   chan error
+	exited   chan struct{}
+	stopping bool
+}
+
+// New creates a service named name that runs the configured process.
+func New(name string, config *Config) (*Service, error) {
+	if config.Command == "" {
+		return nil, errors.New("command must be set")
+	}
+	s := &Service{
+		name:      name,
+		config:    config,
+		logOutput: os.Stdout,
+	}
+	if config.ReadyPattern != "" {
+		pattern, err := regexp.Compile(config.ReadyPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ready pattern: %w", err)
+		}
+		s.readyPattern = pattern
+	}
+	return s, nil
+}
+
+func (s *Service) Name() string {
+	return s.name
+}
+
+// SetLogOutput directs the standard output and error of the process to the
+// writer.
+func (s *Service) SetLogOutput(w io.Writer) {
+	s.logOutput = w
+}
+
+// AssignPorts takes every port of the configuration from the allocator.
+// Ports are assigned in the order of their names.
+func (s *Service) AssignPorts(ports *apollo.PortAllocator) error {
+	names := make([]string, 0, len(s.config.Ports))
+	for name := range s.config.Ports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		port, err := ports.Port(s.config.Ports[name])
+		if err != nil {
+			return fmt.Errorf("port %s: %w", name, err)
+		}
+		s.config.Ports[name] = port
+	}
+	return nil
+}
+
+func (s *Service) EndpointsNeeded() []string {
+	return s.config.EndpointsNeeded
+}
+
+func (s *Service) EndpointsProvided() []string {
+	provided := make([]string, 0, len(s.config.Endpoints))
+	for name := range s.config.Endpoints {
+		provided = append(provided, name)
+	}
+	sort.Strings(provided)
+	return provided
+}
+
+func (s *Service) Setup(_ context.Context, _ string, _ *types.GenesisDoc) (genesis.Modifier, error) {
+	return nil, nil
+}
+
+func (s *Service) Start(ctx context.Context, dir string, _ *types.GenesisDoc, inputs apollo.Endpoints) (apollo.Endpoints, error) {
+	vars := make(map[string]string, 3*len(inputs)+len(s.config.Ports)+1)
+	for name, endpoint := range inputs {
+		vars[name] = endpoint.String()
+		vars[name+".host"] = endpoint.Host
+		vars[name+".port"] = strconv.Itoa(endpoint.Port)
+	}
+	for name, port := range s.config.Ports {
+		vars["port."+name] = strconv.Itoa(port)
+	}
+	vars["dir"] = dir
+
+	cmd, err := s.command(dir, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	ready := make(chan map[string]string, 1)
+	cmd.Stdout = &lineWriter{output: s.logOutput, pattern: s.readyPattern, ready: ready}
+	cmd.Stderr = s.logOutput
+	// don't wait forever for output of child processes that outlive the process
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting %s: %w", s.config.Command, err)
+	}
+
+	exited := make(chan struct{})
+	failed := make(chan error, 1)
+	s.lock.Lock()
+	s.cmd = cmd
+	s.exited = exited
+	s.failed = failed
+	s.stopping = false
+	s.lock.Unlock()
+
+	go func() {
+		err := cmd.Wait()
+		close(exited)
+		s.lock.Lock()
+		stopping := s.stopping
+		s.lock.Unlock()
+		if !stopping {
+			if err == nil {
+				err = errors.New("process exited")
+			}
+			failed <- fmt.Errorf("%s: %w", s.config.Command, err)
+		}
+	}()
+
+	if s.readyPattern == nil {
+		return s.endpoints(vars)
+	}
+	select {
+	case groups := <-ready:
+		for name, value := range groups {
+			vars["ready."+name] = value
+		}
+		return s.endpoints(vars)
+	case <-exited:
+		return nil, fmt.Errorf("%s exited before it was ready: %v", s.config.Command, cmd.ProcessState)
+	case <-ctx.Done():
+		_ = s.Stop(context.Background())
+		return nil, fmt.Errorf("waiting for %s to be ready: %w", s.config.Command, ctx.Err())
+	}
+}
+
+// endpoints templates and parses the endpoints the service provides. The
+// process is stopped if any of them is invalid.
+func (s *Service) endpoints(vars map[string]string) (apollo.Endpoints, error) {
+	endpoints := make(apollo.Endpoints, len(s.config.Endpoints))
+	for name, endpoint := range s.config.Endpoints {
+		value, err := expand(endpoint, vars)
+		if err == nil {
+			endpoints[name], err = apollo.ParseEndpoint(value)
+		}
+		if err != nil {
+			_ = s.Stop(context.Background())
+			return nil, fmt.Errorf("endpoint %s: %w", name, err)
+		}
+	}
+	return endpoints, nil
+}
+
+// command creates the command of the process with its arguments,
+// environment and working directory templated.
+func (s *Service) command(dir string, vars map[string]string) (*osexec.Cmd, error) {
+	args := make([]string, len(s.config.Args))
+	for i, arg := range s.config.Args {
+		var err error
+		if args[i], err = expand(arg, vars); err != nil {
+			return nil, fmt.Errorf("argument %q: %w", arg, err)
+		}
+	}
+	cmd := osexec.Command(s.config.Command, args...)
+
+	cmd.Env = os.Environ()
+	names := make([]string, 0, len(s.config.Env))
+	for name := range s.config.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := expand(s.config.Env[name], vars)
+		if err != nil {
+			return nil, fmt.Errorf("environment variable %s: %w", name, err)
+		}
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+
+	cmd.Dir = dir
+	if s.config.WorkDir != "" {
+		workDir, err := expand(s.config.WorkDir, vars)
+		if err != nil {
+			return nil, fmt.Errorf("working directory: %w", err)
+		}
+		cmd.Dir = workDir
+	}
+	return cmd, nil
+}
+
+// Failed returns a channel that receives an error if the process exits
+// without being stopped.
+func (s *Service) Failed() <-chan error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.failed
+}
+
+// Stop sends SIGTERM to the process and kills it if it hasn't exited within
+// the StopTimeout or before the context is done.
+func (s *Service) Stop(ctx context.Context) error {
+	s.lock.Lock()
+	cmd, exited := s.cmd, s.exited
+	s.stopping = true
+	s.lock.Unlock()
+	if cmd == nil {
+		return nil
+	}
+
+	select {
+	case <-exited:
+		return nil
+	default:
+	}
+
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return s.kill(cmd, exited)
+	}
+	timeout := s.config.StopTimeout
+	if timeout <= 0 {
+		timeout = DefaultStopTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-exited:
+		return nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return s.kill(cmd, exited)
+}
+
+func (s *Service) kill(cmd *osexec.Cmd, exited <-chan struct{}) error {
+	if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("killing %s: %w", s.config.Command, err)
+	}
+	<-exited
+	return nil
+}
+
+// lineWriter copies the standard output of the process to the log output
+// and sends the named groups of the first line that matches the pattern.
+type lineWriter struct {
+	output  io.Writer
+	pattern *regexp.Regexp
+	ready   chan<- map[string]string
+	matched bool
+	line    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if _, err := w.output.Write(p); err != nil {
+		return 0, err
+	}
+	if w.pattern == nil || w.matched {
+		return len(p), nil
+	}
+	w.line = append(w.line, p...)
+	for {
+		i := bytes.IndexByte(w.line, '\n')
+		if i < 0 {
+			break
+		}
+		line := w.line[:i]
+		w.line = w.line[i+1:]
+		match := w.pattern.FindSubmatch(line)
+		if match == nil {
+			continue
+		}
+		groups := make(map[string]string)
+		for i, name := range w.pattern.SubexpNames() {
+			if name != "" {
+				groups[name] = string(match[i])
+			}
+		}
+		w.ready <- groups
+		w.matched = true
+		w.line = nil
+		break
+	}
+	return len(p), nil
+}
+
+var templateVar = regexp.MustCompile(`{{\s*\.([^{}\s]+)\s*}}`)
+
+// expand replaces every "{{.name}}" in s with the value of the variable of
+// that name.
+func expand(s string, vars map[string]string) (string, error) {
+	var missing []string
+	expanded := templateVar.ReplaceAllStringFunc(s, func(match string) string {
+		name := templateVar.FindStringSubmatch(match)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unknown template variables: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
@@ -0,0 +1,120 @@
+package exec
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/celestiaorg/apollo"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a buffer that is safe to write to from the process's
+// output goroutines while the test reads it.
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func TestStartAndStop(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Command = "sh"
+	cfg.Args = []string{"-c", `echo "connecting to {{.cosmos-sdk-grpc}} on port {{.cosmos-sdk-grpc.port}} as $NAME"; echo "serving on 127.0.0.1:{{.port.rpc}}"; exec sleep 30`}
+	cfg.Env = map[string]string{"NAME": "{{.dir}}"}
+	cfg.EndpointsNeeded = []string{"cosmos-sdk-grpc"}
+	cfg.Endpoints = map[string]string{
+		"rollup-rpc":  "http://{{.ready.address}}",
+		"rollup-home": "file://{{.dir}}",
+	}
+	cfg.ReadyPattern = `serving on (?P<address>\S+)`
+	cfg.Ports = map[string]int{"rpc": 26000}
+	service, err := New("rollup", cfg)
+	require.NoError(t, err)
+	require.Equal(t, []string{"rollup-home", "rollup-rpc"}, service.EndpointsProvided())
+
+	logs := &syncBuffer{}
+	service.SetLogOutput(logs)
+	require.NoError(t, service.AssignPorts(apollo.NewPortAllocator().WithOffset(10)))
+
+	dir := t.TempDir()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	endpoints, err := service.Start(ctx, dir, nil, apollo.Endpoints{"cosmos-sdk-grpc": apollo.NewEndpoint("", "localhost", 9090)})
+	require.NoError(t, err)
+	require.Equal(t, apollo.Endpoints{
+		"rollup-rpc":  apollo.NewEndpoint("http", "127.0.0.1", 26010),
+		"rollup-home": apollo.Endpoint{Scheme: "file", Path: dir},
+	}, endpoints)
+	require.Contains(t, logs.String(), "connecting to localhost:9090 on port 9090 as "+dir)
+
+	require.NoError(t, service.Stop(ctx))
+	select {
+	case err := <-service.Failed():
+		t.Fatalf("stopped service reported a failure: %v", err)
+	default:
+	}
+}
+
+func TestKillAfterStopTimeout(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Command = "sh"
+	cfg.Args = []string{"-c", `trap "" TERM; echo ready; while true; do sleep 1; done`}
+	cfg.ReadyPattern = "ready"
+	cfg.StopTimeout = 100 * time.Millisecond
+	service, err := New("stubborn", cfg)
+	require.NoError(t, err)
+	service.SetLogOutput(&syncBuffer{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = service.Start(ctx, t.TempDir(), nil, nil)
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, service.Stop(ctx))
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestReportsExit(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Command = "sh"
+	cfg.Args = []string{"-c", "exit 3"}
+	service, err := New("crashing", cfg)
+	require.NoError(t, err)
+	service.SetLogOutput(&syncBuffer{})
+
+	_, err = service.Start(context.Background(), t.TempDir(), nil, nil)
+	require.NoError(t, err)
+	select {
+	case err := <-service.Failed():
+		require.ErrorContains(t, err, "exit status 3")
+	case <-time.After(5 * time.Second):
+		t.Fatal("exit was not reported")
+	}
+}
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{"bridge-rpc": "http://localhost:26658", "port.p2p": "2121"}
+	expanded, err := expand("--da {{.bridge-rpc}} --p2p {{ .port.p2p }}", vars)
+	require.NoError(t, err)
+	require.Equal(t, "--da http://localhost:26658 --p2p 2121", expanded)
+
+	_, err = expand("{{.light-rpc}}", vars)
+	require.ErrorContains(t, err, "light-rpc")
+	require.True(t, strings.HasPrefix(err.Error(), "unknown template variables"))
+}
@@ -6,11 +6,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"net"
 	"net/http"
 	"strings"
-	"time"
 
 	"log"
 
@@ -32,8 +32,12 @@ import (
 )
 
 var (
-	_   apollo.Service = &Service{}
-	cdc                = encoding.MakeConfig(app.ModuleEncodingRegisters...)
+	_   apollo.Service         = &Service{}
+	_   apollo.HealthChecker   = &Service{}
+	_   apollo.FailureNotifier = &Service{}
+	_   apollo.LogOutputSetter = &Service{}
+	_   apollo.PortAssigner    = &Service{}
+	cdc                        = encoding.MakeConfig(app.ModuleEncodingRegisters...)
 
 	//go:embed web/*
 	web embed.FS
@@ -47,14 +51,45 @@ const (
 type Service struct {
 	config    *Config
 	apiServer http.Server
-	store     *Store
-	keyring   keyring.Keyring
+	// apiAddress is the address the API server is listening on
+	apiAddress string
+	store      *Store
+	conn       *grpc.ClientConn
+	keyring    keyring.Keyring
+	failed     chan error
+	logger     *log.Logger
+}
+
+func init() {
+	apollo.RegisterServiceType(FaucetServiceName, func(_ string, decode func(any) error) (apollo.Service, error) {
+		cfg := DefaultConfig()
+		if err := decode(cfg); err != nil {
+			return nil, err
+		}
+		return New(cfg), nil
+	})
 }
 
 func New(config *Config) *Service {
 	return &Service{
 		config: config,
+		logger: log.Default(),
+	}
+}
+
+// SetLogOutput directs the logs of the faucet to the writer.
+func (s *Service) SetLogOutput(w io.Writer) {
+	s.logger = log.New(w, "", log.LstdFlags)
+}
+
+// AssignPorts takes the port of the faucet API from the allocator.
+func (s *Service) AssignPorts(ports *apollo.PortAllocator) error {
+	address, err := ports.Address(s.config.APIAddress)
+	if err != nil {
+		return err
 	}
+	s.config.APIAddress = address
+	return nil
 }
 
 func (s *Service) Name() string {
@@ -98,16 +133,26 @@ func (s *Service) Setup(ctx context.Context, dir string, pendingGenesis *types.G
 	return genesis.FundAccounts(apollo.Codec().Codec, []sdk.AccAddress{address}, sdk.NewCoin(app.BondDenom, sdk.NewIntFromUint64(s.config.InitialSupply))), nil
 }
 
-func (s *Service) Start(ctx context.Context, dir string, _ *types.GenesisDoc, input apollo.Endpoints) (apollo.Endpoints, error) {
-	conn, err := grpc.Dial(input[consensus.GRPCEndpointLabel], grpc.WithTransportCredentials(insecure.NewCredentials()))
+func (s *Service) Start(ctx context.Context, dir string, _ *types.GenesisDoc, input apollo.Endpoints) (_ apollo.Endpoints, err error) {
+	conn, err := grpc.Dial(input[consensus.GRPCEndpointLabel].HostPort(), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
 
-	s.store, err = NewStore(dir, s.config)
+	store, err := NewStore(dir, s.config)
 	if err != nil {
 		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			store.Close()
+		}
+	}()
 
 	if s.keyring == nil {
 		s.keyring, err = keyring.New(app.Name, keyring.BackendTest, dir, nil, cdc.Codec)
@@ -142,7 +187,7 @@ func (s *Service) Start(ctx context.Context, dir string, _ *types.GenesisDoc, in
 
 		w.Header().Set("Content-Type", "application/json")
 		if _, err := w.Write(stateJSON); err != nil {
-			log.Printf("error writing state response: %s", err.Error())
+			s.logger.Printf("error writing state response: %s", err.Error())
 		}
 	})
 
@@ -156,14 +201,14 @@ func (s *Service) Start(ctx context.Context, dir string, _ *types.GenesisDoc, in
 		addr, err := sdk.AccAddressFromBech32(addrStr)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("invalid address %s: %s", addrStr, err.Error()), http.StatusBadRequest)
-			log.Printf("invalid address from request %s: %s", addrStr, err.Error())
+			s.logger.Printf("invalid address from request %s: %s", addrStr, err.Error())
 			return
 		}
 
-		err = s.store.RequestFunds(addr)
+		err = store.RequestFunds(addr)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("error requesting funds for account %v: %s", addr, err.Error()), http.StatusInternalServerError)
-			log.Printf("error requesting funds for account %v: %s", addr, err.Error())
+			s.logger.Printf("error requesting funds for account %v: %s", addr, err.Error())
 			return
 		}
 
@@ -174,13 +219,13 @@ func (s *Service) Start(ctx context.Context, dir string, _ *types.GenesisDoc, in
 		// TODO: if this fails we should ideally revert the request funds changes to the database
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
-			log.Printf("error submitting send tx to account %s: %s", addr.String(), err.Error())
+			s.logger.Printf("error submitting send tx to account %s: %s", addr.String(), err.Error())
 			return
 		}
 		w.WriteHeader(http.StatusOK)
 		_, err = w.Write([]byte(fmt.Sprintf("Successfully sent %d %s to %s. Transaction hash: %s", s.config.Amount, app.BondDenom, addr.String(), resp.TxHash)))
 		if err != nil {
-			log.Printf("error writing response: %s", err.Error())
+			s.logger.Printf("error writing response: %s", err.Error())
 		}
 	})
 
@@ -197,25 +242,52 @@ func (s *Service) Start(ctx context.Context, dir string, _ *types.GenesisDoc, in
 	if err != nil {
 		return nil, err
 	}
+	addr := listener.Addr().(*net.TCPAddr)
+	s.conn = conn
+	s.store = store
+	s.apiAddress = addr.String()
 	s.apiServer = http.Server{Handler: handler}
-	errCh := make(chan error)
+	s.failed = make(chan error, 1)
 	go func() {
-		errCh <- s.apiServer.Serve(listener)
+		if err := s.apiServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Printf("faucet server stopped unexpectedly: %s", err.Error())
+			s.failed <- err
+		}
 	}()
 
-	select {
-	case err := <-errCh:
-		return nil, err
-	case <-time.After(2 * time.Second):
-	}
-
 	return apollo.Endpoints{
-		FaucetAPILabel: fmt.Sprintf("http://%s", s.config.APIAddress),
+		FaucetAPILabel: apollo.NewEndpoint("http", addr.IP.String(), addr.Port),
 	}, nil
 }
 
+// Health reports the faucet as healthy once its API is serving requests.
+func (s *Service) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/status", s.apiAddress), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("faucet status returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Failed returns a channel that receives an error if the faucet server
+// stops unexpectedly.
+func (s *Service) Failed() <-chan error {
+	return s.failed
+}
+
 func (s *Service) Stop(ctx context.Context) error {
-	return s.apiServer.Shutdown(ctx)
+	if err := s.apiServer.Shutdown(ctx); err != nil {
+		return err
+	}
+	return errors.Join(s.store.Close(), s.conn.Close())
 }
 
 type State struct {
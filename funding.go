@@ -0,0 +1,170 @@
+package apollo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/celestiaorg/apollo/genesis"
+	authtypes "github.com/cosmos/cosmos-sdk/x/auth/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/tendermint/tendermint/types"
+)
+
+// fundingFile is the file in a service's directory that records the
+// balances it still has to be sent before it is first started.
+const fundingFile = "pending-funding.json"
+
+// setupNewService sets up a service that was added to a network whose
+// genesis has already been created. The genesis can't be changed anymore, so
+// the only changes a service may make to it are funding accounts. These
+// balances are recorded and sent by a Funder before the service is started.
+// If the service needs any other changes, its directory is removed again and
+// an error is returned. The caller must hold the operation lock.
+func (c *Conductor) setupNewService(ctx context.Context, name string) (err error) {
+	dir := filepath.Join(c.rootDir, name)
+	c.trackNewDir(dir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory for service %s: %w", name, err)
+	}
+	defer func() {
+		if err != nil {
+			if removeErr := os.RemoveAll(dir); removeErr != nil {
+				c.logger.Printf("failed to remove directory of service %s: %s", name, removeErr.Error())
+			}
+		}
+	}()
+
+	c.logger.Printf("setting up new service %s on the existing network", name)
+	modifier, err := c.setupService(ctx, name, dir, c.genesisDoc)
+	if err != nil {
+		return fmt.Errorf("failed to setup service %s: %w", name, err)
+	}
+	if modifier == nil {
+		return nil
+	}
+	balances, err := fundingFromModifier(c.genesisDoc, modifier)
+	if err != nil {
+		return fmt.Errorf("service %s can't be added to an existing network: %w. Please clear %s and restart", name, err, c.rootDir)
+	}
+	if len(balances) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(balances)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, fundingFile), data, 0o644); err != nil {
+		return fmt.Errorf("failed to save pending funding of service %s: %w", name, err)
+	}
+	c.funding[name] = balances
+	return nil
+}
+
+// loadFunding reads the balances that a service set up on an existing
+// network is still waiting for. The caller must hold the operation lock.
+func (c *Conductor) loadFunding(name string) error {
+	data, err := os.ReadFile(filepath.Join(c.rootDir, name, fundingFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var balances []banktypes.Balance
+	if err := json.Unmarshal(data, &balances); err != nil {
+		return fmt.Errorf("failed to read pending funding of service %s: %w", name, err)
+	}
+	c.funding[name] = balances
+	return nil
+}
+
+// fundService sends the pending balances of a service from a running
+// Funder. The caller must hold the operation lock.
+func (c *Conductor) fundService(ctx context.Context, name string) error {
+	balances, ok := c.funding[name]
+	if !ok {
+		return nil
+	}
+	c.lock.RLock()
+	var funder Funder
+	for _, active := range c.startOrder {
+		if f, ok := c.activeServices[active].(Funder); ok {
+			funder = f
+			break
+		}
+	}
+	c.lock.RUnlock()
+	if funder == nil {
+		return fmt.Errorf("service %s is waiting for its accounts to be funded but no running service can fund them", name)
+	}
+
+	if err := funder.Fund(ctx, balances); err != nil {
+		return fmt.Errorf("failed to fund accounts of service %s: %w", name, err)
+	}
+	if err := os.Remove(filepath.Join(c.rootDir, name, fundingFile)); err != nil {
+		return err
+	}
+	delete(c.funding, name)
+	c.logService(name, "funded accounts %v", balances)
+	return nil
+}
+
+// fundingFromModifier applies a genesis modifier to the app state of a
+// genesis that has already been created and returns the balances it adds.
+// An error is returned if the modifier changes any state other than the
+// accounts and their balances.
+func fundingFromModifier(doc *types.GenesisDoc, modifier genesis.Modifier) ([]banktypes.Balance, error) {
+	var state map[string]json.RawMessage
+	if err := json.Unmarshal(doc.AppState, &state); err != nil {
+		return nil, err
+	}
+	modified := make(map[string]json.RawMessage, len(state))
+	for module, moduleState := range state {
+		modified[module] = moduleState
+	}
+	modified = modifier(modified)
+
+	var changed []string
+	for module, moduleState := range modified {
+		if module == authtypes.ModuleName || module == banktypes.ModuleName {
+			continue
+		}
+		if !bytes.Equal(state[module], moduleState) {
+			changed = append(changed, module)
+		}
+	}
+	if len(changed) > 0 {
+		sort.Strings(changed)
+		return nil, fmt.Errorf("it changes the %s genesis state", strings.Join(changed, ", "))
+	}
+
+	var before, after banktypes.GenesisState
+	if err := cdc.Codec.UnmarshalJSON(state[banktypes.ModuleName], &before); err != nil {
+		return nil, err
+	}
+	if err := cdc.Codec.UnmarshalJSON(modified[banktypes.ModuleName], &after); err != nil {
+		return nil, err
+	}
+	existing := make(map[string]banktypes.Balance, len(before.Balances))
+	for _, balance := range before.Balances {
+		existing[balance.Address] = balance
+	}
+	var balances []banktypes.Balance
+	for _, balance := range after.Balances {
+		added, negative := balance.Coins.SafeSub(existing[balance.Address].Coins...)
+		if negative {
+			return nil, fmt.Errorf("it reduces the balance of %s", balance.Address)
+		}
+		if !added.IsZero() {
+			balances = append(balances, banktypes.Balance{Address: balance.Address, Coins: added})
+		}
+	}
+	return balances, nil
+}
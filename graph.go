@@ -0,0 +1,151 @@
+package apollo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dependencies returns, for each service, the names of the services that
+// provide at least one of the endpoints it needs. If an endpoint is provided
+// by more than one service, the service depends on all of them.
+func dependencies(services map[string]Service) map[string][]string {
+	providers := make(map[string][]string)
+	for name, service := range services {
+		for _, endpoint := range service.EndpointsProvided() {
+			providers[endpoint] = append(providers[endpoint], name)
+		}
+	}
+
+	deps := make(map[string][]string, len(services))
+	for name, service := range services {
+		seen := make(map[string]bool)
+		deps[name] = []string{}
+		for _, endpoint := range service.EndpointsNeeded() {
+			for _, provider := range providers[endpoint] {
+				if provider == name || seen[provider] {
+					continue
+				}
+				seen[provider] = true
+				deps[name] = append(deps[name], provider)
+			}
+		}
+	}
+	return deps
+}
+
+// closure returns the given service and every service it reaches by
+// following the edges transitively.
+func closure(name string, edges map[string][]string) map[string]bool {
+	reached := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for _, other := range edges[next] {
+			if !reached[other] {
+				reached[other] = true
+				queue = append(queue, other)
+			}
+		}
+	}
+	return reached
+}
+
+// dependents inverts the dependencies, returning for each service the
+// services that depend on it.
+func dependents(deps map[string][]string) map[string][]string {
+	inverted := make(map[string][]string, len(deps))
+	for name, providers := range deps {
+		for _, provider := range providers {
+			inverted[provider] = append(inverted[provider], name)
+		}
+	}
+	return inverted
+}
+
+// sortServices topologically sorts the services into layers. Every service
+// in a layer only depends on services in earlier layers, so all services
+// within a layer can be started concurrently. Within a layer, services keep
+// the relative order in which they were provided. An error is returned if the
+// dependencies between services form a cycle.
+func sortServices(order []string, services map[string]Service) ([][]string, error) {
+	deps := dependencies(services)
+	layers := make([][]string, 0)
+	done := make(map[string]bool, len(order))
+
+	for sorted := 0; sorted < len(order); {
+		layer := make([]string, 0)
+		for _, name := range order {
+			if done[name] {
+				continue
+			}
+			ready := true
+			for _, dep := range deps[name] {
+				if !done[dep] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				layer = append(layer, name)
+			}
+		}
+		if len(layer) == 0 {
+			return nil, fmt.Errorf("dependency cycle detected between services: %s", findCycle(order, deps, done))
+		}
+		for _, name := range layer {
+			done[name] = true
+		}
+		sorted += len(layer)
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+// findCycle walks the dependencies of the services that could not be sorted
+// and returns a readable description of the first cycle it finds.
+func findCycle(order []string, deps map[string][]string, done map[string]bool) string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if done[dep] {
+				continue
+			}
+			switch state[dep] {
+			case visiting:
+				for i, n := range path {
+					if n == dep {
+						return append(append([]string{}, path[i:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+
+	for _, name := range order {
+		if done[name] || state[name] != unvisited {
+			continue
+		}
+		if cycle := visit(name); cycle != nil {
+			return strings.Join(cycle, " -> ")
+		}
+	}
+	return ""
+}
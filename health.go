@@ -0,0 +1,114 @@
+package apollo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// readinessInterval is how often a service is probed while it is
+	// starting up.
+	readinessInterval = 250 * time.Millisecond
+	// livenessInterval is how often a running service is probed.
+	livenessInterval = 5 * time.Second
+	// healthHistoryLength is the number of recent health checks that are
+	// kept for each service.
+	healthHistoryLength = 30
+)
+
+// Health records the results of probing a service that implements the
+// HealthChecker interface.
+type Health struct {
+	Healthy             bool          `json:"healthy"`
+	LastChecked         time.Time     `json:"last_checked"`
+	LastHealthy         time.Time     `json:"last_healthy"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	Error               string        `json:"error,omitempty"`
+	History             []HealthCheck `json:"history"`
+}
+
+// HealthCheck is the result of a single probe.
+type HealthCheck struct {
+	Time    time.Time `json:"time"`
+	Healthy bool      `json:"healthy"`
+}
+
+func (h *Health) record(err error) {
+	now := time.Now()
+	h.LastChecked = now
+	h.Healthy = err == nil
+	if err == nil {
+		h.LastHealthy = now
+		h.ConsecutiveFailures = 0
+		h.Error = ""
+	} else {
+		h.ConsecutiveFailures++
+		h.Error = err.Error()
+	}
+	h.History = append(h.History, HealthCheck{Time: now, Healthy: h.Healthy})
+	if len(h.History) > healthHistoryLength {
+		h.History = h.History[len(h.History)-healthHistoryLength:]
+	}
+}
+
+func (h *Health) copy() *Health {
+	cp := *h
+	cp.History = append([]HealthCheck{}, h.History...)
+	return &cp
+}
+
+// checkHealth probes the service once and records the result.
+func (c *Conductor) checkHealth(ctx context.Context, name string, checker HealthChecker) error {
+	err := checker.Health(ctx)
+	c.healthLock.Lock()
+	defer c.healthLock.Unlock()
+	health, ok := c.health[name]
+	if !ok {
+		health = &Health{}
+		c.health[name] = health
+	}
+	wasHealthy := health.Healthy
+	health.record(err)
+	if ok && wasHealthy != health.Healthy {
+		c.emit(EventHealthChanged, name, nil, err)
+	}
+	return err
+}
+
+// waitUntilReady polls the service until it reports that it is healthy.
+// An error is returned if the context is cancelled first, which happens
+// once the start timeout of the service has passed.
+func (c *Conductor) waitUntilReady(ctx context.Context, name string, checker HealthChecker) error {
+	ticker := time.NewTicker(readinessInterval)
+	defer ticker.Stop()
+	for {
+		err := c.checkHealth(ctx, name, checker)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("service %s did not become ready: %w", name, err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// clearHealth removes the health records of a service.
+func (c *Conductor) clearHealth(name string) {
+	c.healthLock.Lock()
+	defer c.healthLock.Unlock()
+	delete(c.health, name)
+}
+
+// consecutiveFailures returns the number of health checks in a row that
+// the service has failed.
+func (c *Conductor) consecutiveFailures(name string) int {
+	c.healthLock.Lock()
+	defer c.healthLock.Unlock()
+	if health, ok := c.health[name]; ok {
+		return health.ConsecutiveFailures
+	}
+	return 0
+}
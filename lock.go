@@ -0,0 +1,143 @@
+package apollo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// LockFile is the name of the file within the Apollo directory that holds
+// the PID of the process running the network. The process keeps the file
+// locked so that no other process can use the same directory.
+const LockFile = "apollo.pid"
+
+// ErrInUse is returned if another process holds the lock on an Apollo
+// directory.
+var ErrInUse = errors.New("in use")
+
+// errLocked is returned by lockFile if another process holds the lock.
+var errLocked = errors.New("file is locked")
+
+// acquireLock locks the Apollo directory for this process. The lock is
+// released by Close or when the process exits, so a PID that is left in the
+// lock file belongs to a process that crashed. The caller must hold the
+// operation lock.
+func (c *Conductor) acquireLock() error {
+	if c.lockFile != nil {
+		return nil
+	}
+	f, stalePID, err := lockDir(c.rootDir)
+	if err != nil {
+		return err
+	}
+	if stalePID != 0 {
+		c.logger.Printf("removing stale lock of process %d which is no longer running", stalePID)
+	}
+	c.lockFile = f
+	return nil
+}
+
+// LockDir locks the Apollo directory for this process in the same way as
+// Conductor.Setup, so that a network that isn't running can be worked on
+// without a Conductor starting it at the same time. It returns an error
+// wrapping ErrInUse if the network is running. The returned function
+// releases the lock.
+func LockDir(dir string) (func() error, error) {
+	f, _, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return func() error { return unlockDir(f) }, nil
+}
+
+// lockDir locks the lock file of the Apollo directory and writes the PID of
+// this process to it. It returns the PID that was left in the file by a
+// process that crashed, if any.
+func lockDir(dir string) (*os.File, int, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, 0, fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, LockFile)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, errLocked) {
+			return nil, 0, inUseError(dir)
+		}
+		return nil, 0, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	stalePID, _ := readPID(f)
+	if err := writePID(f); err != nil {
+		return nil, 0, errors.Join(fmt.Errorf("failed to write lock file: %w", err), unlockFile(f), f.Close())
+	}
+	return f, stalePID, nil
+}
+
+// inUseError describes the process that holds the lock on the Apollo
+// directory.
+func inUseError(dir string) error {
+	owner := "another process"
+	if data, err := os.ReadFile(filepath.Join(dir, LockFile)); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			owner = fmt.Sprintf("process %d", pid)
+		}
+	}
+	if address, err := ReadPanelAddress(dir); err == nil {
+		owner += " with its control panel at " + address
+	}
+	return fmt.Errorf("Apollo directory %s is %w by %s. Stop that network first or use another directory", dir, ErrInUse, owner)
+}
+
+// Close releases the lock on the Apollo directory that is taken by Setup,
+// so that the network can be run by another Conductor or process. Services
+// should be stopped first. Run closes the Conductor when it returns.
+func (c *Conductor) Close() error {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+
+	return c.releaseLock()
+}
+
+// releaseLock releases the lock on the Apollo directory. The lock file is
+// emptied rather than removed so that another process can't lock a file
+// that is about to be deleted. The caller must hold the operation lock.
+func (c *Conductor) releaseLock() error {
+	if c.lockFile == nil {
+		return nil
+	}
+	f := c.lockFile
+	c.lockFile = nil
+	return unlockDir(f)
+}
+
+// unlockDir releases the lock taken by lockDir.
+func unlockDir(f *os.File) error {
+	return errors.Join(f.Truncate(0), unlockFile(f), f.Close())
+}
+
+func readPID(f *os.File) (int, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func writePID(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return err
+}
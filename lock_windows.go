@@ -0,0 +1,28 @@
+//go:build windows
+
+package apollo
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// the lock covers a byte far beyond the PID so that other processes can
+// still read it
+var lockRange = windows.Overlapped{OffsetHigh: 1}
+
+func lockFile(f *os.File) error {
+	overlapped := lockRange
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &overlapped)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	overlapped := lockRange
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &overlapped)
+}
@@ -0,0 +1,285 @@
+package apollo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// LogFileName is the name of the file within each service's directory
+	// that the service's logs are written to.
+	LogFileName = "service.log"
+	// maxLogSize is the size in bytes after which a log file is rotated.
+	maxLogSize = 10 << 20
+	// maxLogBackups is the number of rotated log files that are kept.
+	maxLogBackups = 3
+	// defaultTailLines is the number of lines returned by /logs/<service>
+	// if no tail is specified.
+	defaultTailLines = 100
+)
+
+// logSink is a size-rotated log file that can be followed. Writes are
+// appended to the file and copied to every follower.
+type logSink struct {
+	lock      sync.Mutex
+	path      string
+	file      *os.File
+	size      int64
+	followers map[chan []byte]struct{}
+}
+
+func newLogSink(path string) (*logSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("opening log file: %w", err)
+	}
+	return &logSink{
+		path:      path,
+		file:      file,
+		size:      info.Size(),
+		followers: make(map[chan []byte]struct{}),
+	}, nil
+}
+
+func (s *logSink) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file == nil {
+		return 0, os.ErrClosed
+	}
+	if s.size+int64(len(p)) > maxLogSize {
+		if err := s.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	for ch := range s.followers {
+		select {
+		case ch <- append([]byte{}, p[:n]...):
+		default:
+			// drop output for followers that can't keep up
+		}
+	}
+	return n, err
+}
+
+// rotate renames service.log to service.log.1, shifting older backups and
+// removing the oldest, and then opens a new log file.
+func (s *logSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	for i := maxLogBackups - 1; i > 0; i-- {
+		from := fmt.Sprintf("%s.%d", s.path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, fmt.Sprintf("%s.%d", s.path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.size = 0
+	return nil
+}
+
+// follow returns the last n lines of the current log file together with a
+// channel that receives everything written to the sink afterwards, until
+// the context is cancelled.
+func (s *logSink) follow(ctx context.Context, n int) ([]byte, <-chan []byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	data, err := s.readTail(n)
+	if err != nil {
+		return nil, nil, err
+	}
+	ch := make(chan []byte, eventBufferSize)
+	s.followers[ch] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		s.lock.Lock()
+		delete(s.followers, ch)
+		s.lock.Unlock()
+		close(ch)
+	}()
+	return data, ch, nil
+}
+
+// readTail returns the last n lines of the current log file. The caller
+// must hold the lock.
+func (s *logSink) readTail(n int) ([]byte, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimRight(data, "\n")
+	if len(data) == 0 || n == 0 {
+		return nil, nil
+	}
+	start := len(data)
+	for i := 0; i < n && start > 0; i++ {
+		start = bytes.LastIndexByte(data[:start], '\n')
+		if start < 0 {
+			start = 0
+			break
+		}
+	}
+	if data[start] == '\n' {
+		start++
+	}
+	return append(data[start:], '\n'), nil
+}
+
+// tail returns the last n lines of the current log file.
+func (s *logSink) tail(n int) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.readTail(n)
+}
+
+func (s *logSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// openLogs creates the log sink of every service that doesn't have one yet
+// and hands it to the service if it implements LogOutputSetter.
+func (c *Conductor) openLogs() error {
+	c.logLock.Lock()
+	defer c.logLock.Unlock()
+	for name, service := range c.services {
+		if _, ok := c.logs[name]; ok {
+			continue
+		}
+		sink, err := newLogSink(filepath.Join(c.rootDir, name, LogFileName))
+		if err != nil {
+			return fmt.Errorf("failed to create log for service %s: %w", name, err)
+		}
+		c.logs[name] = sink
+		if setter, ok := service.(LogOutputSetter); ok {
+			setter.SetLogOutput(sink)
+		}
+	}
+	return nil
+}
+
+// closeLogs closes the log sinks of all services.
+func (c *Conductor) closeLogs() {
+	c.logLock.Lock()
+	defer c.logLock.Unlock()
+	for name, sink := range c.logs {
+		if err := sink.Close(); err != nil {
+			c.logger.Printf("failed to close log for service %s: %s", name, err.Error())
+		}
+		delete(c.logs, name)
+	}
+}
+
+// logService writes a message from the Conductor about a service to that
+// service's log.
+func (c *Conductor) logService(name, format string, args ...interface{}) {
+	c.logLock.RLock()
+	sink, ok := c.logs[name]
+	c.logLock.RUnlock()
+	if !ok {
+		return
+	}
+	msg := fmt.Sprintf("%s apollo: %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+	if _, err := io.WriteString(sink, msg); err != nil {
+		c.logger.Printf("failed to write to log of service %s: %s", name, err.Error())
+	}
+}
+
+// serveLogs writes the last lines of a service's log to the client. The
+// "tail" query parameter sets the number of lines, and if "follow" is true
+// the response stays open and streams new output as it is written.
+func (c *Conductor) serveLogs(ctx context.Context, w http.ResponseWriter, r *http.Request, name string) {
+	c.logLock.RLock()
+	sink, ok := c.logs[name]
+	c.logLock.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("no logs for service %s", name), http.StatusNotFound)
+		return
+	}
+
+	lines := defaultTailLines
+	if tail := r.URL.Query().Get("tail"); tail != "" {
+		n, err := strconv.Atoi(tail)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid tail %q", tail), http.StatusBadRequest)
+			return
+		}
+		lines = n
+	}
+	follow, _ := strconv.ParseBool(r.URL.Query().Get("follow"))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		data   []byte
+		output <-chan []byte
+		err    error
+	)
+	if follow {
+		disableWriteTimeout(w)
+		data, output, err = sink.follow(ctx, lines)
+	} else {
+		data, err = sink.tail(lines)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := w.Write(data); err != nil || !follow {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return
+	}
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case chunk, ok := <-output:
+			if !ok {
+				return
+			}
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
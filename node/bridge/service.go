@@ -2,7 +2,9 @@ package bridge
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -16,11 +18,16 @@ import (
 	"github.com/celestiaorg/celestia-node/nodebuilder/node"
 	"github.com/celestiaorg/celestia-node/nodebuilder/p2p"
 	"github.com/cosmos/cosmos-sdk/crypto/keyring"
-	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/tendermint/tendermint/types"
 )
 
-var _ apollo.Service = &Service{}
+var (
+	_ apollo.Service         = &Service{}
+	_ apollo.ConfigReloader  = &Service{}
+	_ apollo.HealthChecker   = &Service{}
+	_ apollo.PortAssigner    = &Service{}
+	_ apollo.LogOutputSetter = &Service{}
+)
 
 const (
 	BridgeServiceName = "bridge-node"
@@ -35,9 +42,22 @@ type Service struct {
 	store   nodebuilder.Store
 	chainID string
 	config  *nodebuilder.Config
+	// logOutput receives the output of celestia-node's loggers
+	logOutput io.Writer
+}
+
+func init() {
+	apollo.RegisterServiceType(BridgeServiceName, func(_ string, decode func(any) error) (apollo.Service, error) {
+		cfg := nodebuilder.DefaultConfig(node.Bridge)
+		if err := decode(cfg); err != nil {
+			return nil, err
+		}
+		return New(cfg), nil
+	})
 }
 
 func New(config *nodebuilder.Config) *Service {
+	config.RPC.Port = RPCPort
 	return &Service{
 		config: config,
 	}
@@ -47,6 +67,23 @@ func (s *Service) Name() string {
 	return BridgeServiceName
 }
 
+// ReloadConfig re-reads the node's config.toml so that changes to it take
+// effect when the node is started again.
+func (s *Service) ReloadConfig(dir string) error {
+	cfg, err := util.ReloadNodeConfig(dir, s.config)
+	if err != nil {
+		return err
+	}
+	s.config = cfg
+	return nil
+}
+
+// AssignPorts takes the ports of the RPC, gateway and P2P servers from the
+// allocator.
+func (s *Service) AssignPorts(ports *apollo.PortAllocator) error {
+	return util.AssignNodePorts(ports, s.config)
+}
+
 func (s *Service) EndpointsNeeded() []string {
 	return []string{consensus.RPCEndpointLabel, consensus.GRPCEndpointLabel}
 }
@@ -59,22 +96,41 @@ func (s *Service) Setup(ctx context.Context, dir string, pendingGenesis *types.G
 	return nil, nodebuilder.Init(*s.config, dir, node.Bridge)
 }
 
+// SetLogOutput directs the output of celestia-node's loggers to the writer
+// while the node runs. The loggers are shared by all nodes in the process,
+// so the output of other nodes that run at the same time is written to it
+// as well.
+func (s *Service) SetLogOutput(w io.Writer) {
+	s.logOutput = w
+}
+
 func (s *Service) Start(ctx context.Context, dir string, genesis *types.GenesisDoc, inputs apollo.Endpoints) (apollo.Endpoints, error) {
+	if s.logOutput != nil {
+		util.RouteNodeLogs(BridgeServiceName, s.logOutput)
+	}
+	endpoints, err := s.start(ctx, dir, genesis, inputs)
+	if err != nil {
+		util.StopNodeLogs(BridgeServiceName)
+	}
+	return endpoints, err
+}
+
+func (s *Service) start(ctx context.Context, dir string, genesis *types.GenesisDoc, inputs apollo.Endpoints) (apollo.Endpoints, error) {
 	s.chainID = genesis.ChainID
 	rpcEndpoint, ok := inputs[consensus.RPCEndpointLabel]
 	if !ok {
 		return nil, fmt.Errorf("RPC endpoint not provided")
 	}
 
-	headerHash, err := util.GetTrustedHash(ctx, rpcEndpoint)
+	headerHash, err := util.GetTrustedHash(ctx, rpcEndpoint.String())
 	if err != nil {
 		return nil, err
 	}
 	s.config.Header.TrustedHash = headerHash
-	s.config.RPC.Port = RPCPort
 
-	// TODO: we don't take the consensus nodes endpoints here and inject them into the config,
-	// instead we assume they are the same as the defaults
+	if err := util.SetCoreEndpoints(&s.config.Core, rpcEndpoint, inputs[consensus.GRPCEndpointLabel]); err != nil {
+		return nil, err
+	}
 
 	encConf := encoding.MakeConfig(app.ModuleEncodingRegisters...)
 
@@ -94,22 +150,38 @@ func (s *Service) Start(ctx context.Context, dir string, genesis *types.GenesisD
 		return nil, err
 	}
 
-	addrInfo, err := host.InfoFromHost(s.node.Host).MarshalJSON()
+	p2pEndpoint, err := util.P2PEndpoint(s.node.Host)
+	if err != nil {
+		return nil, err
+	}
+	bridgeRPCEndpoint, err := util.RPCEndpoint(s.config.RPC.Port)
 	if err != nil {
 		return nil, err
 	}
 
-	endpoints := map[string]string{
-		RPCEndpointLabel: fmt.Sprintf("http://localhost:%s", s.config.RPC.Port),
-		P2PEndpointLabel: string(addrInfo),
+	endpoints := apollo.Endpoints{
+		RPCEndpointLabel: bridgeRPCEndpoint,
+		P2PEndpointLabel: p2pEndpoint,
 	}
 
 	return endpoints, s.node.Start(ctx)
 }
 
+// Health reports the node as healthy once it has a local head.
+func (s *Service) Health(ctx context.Context) error {
+	if s.node == nil {
+		return errors.New("node has not been started")
+	}
+	if _, err := s.node.HeaderServ.LocalHead(ctx); err != nil {
+		return fmt.Errorf("getting local head: %w", err)
+	}
+	return nil
+}
+
 func (s *Service) Stop(ctx context.Context) error {
 	if err := s.node.Stop(ctx); err != nil {
 		return err
 	}
+	util.StopNodeLogs(BridgeServiceName)
 	return s.store.Close()
 }
@@ -0,0 +1,64 @@
+package consensus
+
+import (
+	"time"
+
+	"github.com/celestiaorg/apollo"
+	"github.com/celestiaorg/celestia-app/app"
+	"github.com/celestiaorg/celestia-app/test/util/testnode"
+)
+
+func init() {
+	apollo.RegisterServiceType(ConsensusServiceName, func(_ string, decode func(any) error) (apollo.Service, error) {
+		var overrides ConfigOverrides
+		if err := decode(&overrides); err != nil {
+			return nil, err
+		}
+		cfg := DefaultConfig()
+		overrides.Apply(cfg)
+		return New(cfg), nil
+	})
+}
+
+// DefaultConfig returns the configuration of a single validator network
+// used by the CLI. Its application can be restarted within the same process.
+func DefaultConfig() *Config {
+	return testnode.DefaultConfig().
+		WithTendermintConfig(app.DefaultConsensusConfig()).
+		WithAppConfig(app.DefaultAppConfig()).
+		WithAppCreator(NewAppServer)
+}
+
+// ConfigOverrides are the parts of the configuration of the consensus node
+// that can be set in a network definition. Fields that aren't set keep
+// their default value.
+type ConfigOverrides struct {
+	TimeoutCommit  time.Duration `toml:"timeout_commit"`
+	TimeoutPropose time.Duration `toml:"timeout_propose"`
+	MinGasPrices   string        `toml:"min_gas_prices"`
+	RPCAddress     string        `toml:"rpc_address"`
+	GRPCAddress    string        `toml:"grpc_address"`
+	APIAddress     string        `toml:"api_address"`
+}
+
+// Apply sets the fields of the configuration that are overridden.
+func (o ConfigOverrides) Apply(cfg *Config) {
+	if o.TimeoutCommit != 0 {
+		cfg.TmConfig.Consensus.TimeoutCommit = o.TimeoutCommit
+	}
+	if o.TimeoutPropose != 0 {
+		cfg.TmConfig.Consensus.TimeoutPropose = o.TimeoutPropose
+	}
+	if o.MinGasPrices != "" {
+		cfg.AppConfig.MinGasPrices = o.MinGasPrices
+	}
+	if o.RPCAddress != "" {
+		cfg.TmConfig.RPC.ListenAddress = o.RPCAddress
+	}
+	if o.GRPCAddress != "" {
+		cfg.AppConfig.GRPC.Address = o.GRPCAddress
+	}
+	if o.APIAddress != "" {
+		cfg.AppConfig.API.Address = o.APIAddress
+	}
+}
@@ -2,11 +2,12 @@ package consensus
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"path/filepath"
 	"time"
 
 	"github.com/celestiaorg/celestia-app/test/util/testnode"
+	cmtdb "github.com/cometbft/cometbft-db"
 	"github.com/cosmos/cosmos-sdk/client/flags"
 	"github.com/cosmos/cosmos-sdk/server/api"
 	srvconfig "github.com/cosmos/cosmos-sdk/server/config"
@@ -23,13 +24,13 @@ import (
 
 // NewCometNode creates a ready to use comet node that operates a single
 // validator celestia-app network. It expects that all configuration files are
-// already initialized and saved to the baseDir.
-func NewCometNode(baseDir string, cfg *Config) (*node.Node, srvtypes.Application, error) {
+// already initialized and saved to the baseDir. Logs are written to output.
+func NewCometNode(baseDir string, cfg *Config, output io.Writer) (*node.Node, srvtypes.Application, error) {
 	var logger log.Logger
 	if cfg.SupressLogs {
 		logger = log.NewNopLogger()
 	} else {
-		logger = log.NewTMLogger(log.NewSyncWriter(os.Stdout))
+		logger = log.NewTMLogger(log.NewSyncWriter(output))
 		logger = log.NewFilter(logger, log.AllowError())
 	}
 
@@ -42,6 +43,16 @@ func NewCometNode(baseDir string, cfg *Config) (*node.Node, srvtypes.Application
 	cfg.AppOptions.Set(flags.FlagHome, baseDir)
 
 	app := cfg.AppCreator(logger, db, nil, cfg.AppOptions)
+	// the node doesn't close the application database or that of the tx
+	// indexer, so they are closed together with the application
+	dbs := []io.Closer{db}
+	dbProvider := func(ctx *node.DBContext) (cmtdb.DB, error) {
+		db, err := node.DefaultDBProvider(ctx)
+		if err == nil && ctx.ID == "tx_index" {
+			dbs = append(dbs, db)
+		}
+		return db, err
+	}
 
 	nodeKey, err := p2p.LoadOrGenNodeKey(cfg.TmConfig.NodeKeyFile())
 	if err != nil {
@@ -54,12 +65,12 @@ func NewCometNode(baseDir string, cfg *Config) (*node.Node, srvtypes.Application
 		nodeKey,
 		proxy.NewLocalClientCreator(app),
 		node.DefaultGenesisDocProviderFunc(cfg.TmConfig),
-		node.DefaultDBProvider,
+		dbProvider,
 		node.DefaultMetricsProvider(cfg.TmConfig.Instrumentation),
 		logger,
 	)
 
-	return tmNode, app, err
+	return tmNode, closingApp{Application: app, dbs: dbs}, err
 }
 
 func StartAPIServer(app srvtypes.Application, appCfg srvconfig.Config, cctx testnode.Context) (*api.Server, error) {
@@ -2,6 +2,10 @@ package consensus
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"time"
 
@@ -10,12 +14,14 @@ import (
 	"github.com/celestiaorg/celestia-app/app"
 	"github.com/celestiaorg/celestia-app/app/encoding"
 	"github.com/celestiaorg/celestia-app/pkg/appconsts"
+	"github.com/celestiaorg/celestia-app/pkg/user"
 	"github.com/celestiaorg/celestia-app/test/util/testnode"
 	"github.com/cosmos/cosmos-sdk/crypto/hd"
 	"github.com/cosmos/cosmos-sdk/crypto/keyring"
 	cryptotypes "github.com/cosmos/cosmos-sdk/crypto/types"
 	serverconfig "github.com/cosmos/cosmos-sdk/server/config"
 	sdk "github.com/cosmos/cosmos-sdk/types"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
 	"github.com/tendermint/tendermint/config"
 	tmos "github.com/tendermint/tendermint/libs/os"
 	"github.com/tendermint/tendermint/privval"
@@ -33,7 +39,13 @@ const (
 
 type Config = testnode.Config
 
-var _ apollo.Service = &Service{}
+var (
+	_ apollo.Service         = &Service{}
+	_ apollo.Funder          = &Service{}
+	_ apollo.HealthChecker   = &Service{}
+	_ apollo.LogOutputSetter = &Service{}
+	_ apollo.PortAssigner    = &Service{}
+)
 
 var (
 	cdc = encoding.MakeConfig(app.ModuleEncodingRegisters...)
@@ -41,16 +53,18 @@ var (
 
 type Service struct {
 	testnode.Context
-	config  *Config
-	chainID string
-	closers []func() error
+	config    *Config
+	chainID   string
+	closers   []func() error
+	logOutput io.Writer
 }
 
 func New(config *Config) *Service {
 	// override some config values
 	config.TmConfig.TxIndex.Indexer = "kv"
 	return &Service{
-		config: config,
+		config:    config,
+		logOutput: os.Stdout,
 	}
 }
 
@@ -58,6 +72,33 @@ func (s *Service) Name() string {
 	return ConsensusServiceName
 }
 
+// SetLogOutput directs the logs of the comet node to the writer.
+func (s *Service) SetLogOutput(w io.Writer) {
+	s.logOutput = w
+}
+
+// AssignPorts takes the ports of the comet RPC and P2P servers and the
+// cosmos-sdk gRPC and API servers from the allocator.
+func (s *Service) AssignPorts(ports *apollo.PortAllocator) error {
+	addresses := []*string{
+		&s.config.TmConfig.RPC.ListenAddress,
+		&s.config.TmConfig.P2P.ListenAddress,
+		&s.config.AppConfig.GRPC.Address,
+		&s.config.AppConfig.API.Address,
+	}
+	if s.config.AppConfig.GRPCWeb.Enable {
+		addresses = append(addresses, &s.config.AppConfig.GRPCWeb.Address)
+	}
+	for _, address := range addresses {
+		assigned, err := ports.Address(*address)
+		if err != nil {
+			return err
+		}
+		*address = assigned
+	}
+	return nil
+}
+
 func (s *Service) EndpointsNeeded() []string {
 	return []string{}
 }
@@ -146,7 +187,7 @@ func (s *Service) Start(ctx context.Context, dir string, genesis *types.GenesisD
 	}
 	s.chainID = genesis.ChainID
 
-	tmNode, app, err := NewCometNode(dir, s.config)
+	tmNode, app, err := NewCometNode(dir, s.config, s.logOutput)
 	if err != nil {
 		return nil, err
 	}
@@ -188,22 +229,75 @@ func (s *Service) Start(ctx context.Context, dir string, genesis *types.GenesisD
 
 	// close these sub services in reverse order
 	s.closers = []func() error{
-		apiServer.Close, cleanupGRPC, stopNode,
+		apiServer.Close, cleanupGRPC, stopNode, app.Close,
 	}
 
-	return apollo.Endpoints{
+	endpoints := apollo.Endpoints{
+		APIDocsLabel: apollo.MustParseEndpoint(DocsEndpint),
+	}
+	for label, address := range map[string]string{
 		RPCEndpointLabel:  s.config.TmConfig.RPC.ListenAddress,
 		GRPCEndpointLabel: s.config.AppConfig.GRPC.Address,
 		APIEndpointLabel:  s.config.AppConfig.API.Address,
-		APIDocsLabel:      DocsEndpint,
-	}, nil
+	} {
+		endpoint, err := apollo.ParseEndpoint(address)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", label, err)
+		}
+		endpoints[label] = endpoint
+	}
+	return endpoints, nil
 }
 
-func (s *Service) Stop(context.Context) error {
-	for _, closer := range s.closers {
-		if err := closer(); err != nil {
+// Health reports the node as healthy once it is producing blocks and
+// responding to RPC requests.
+func (s *Service) Health(ctx context.Context) error {
+	if s.Client == nil {
+		return errors.New("node has not been started")
+	}
+	status, err := s.Client.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("querying node status: %w", err)
+	}
+	if status.SyncInfo.LatestBlockHeight < 1 {
+		return errors.New("node has not yet produced its first block")
+	}
+	return nil
+}
+
+// Fund sends the balances from the validator's account in a single
+// transaction and waits for it to be committed.
+func (s *Service) Fund(ctx context.Context, balances []banktypes.Balance) error {
+	if s.GRPCClient == nil {
+		return errors.New("node has not been started")
+	}
+	signer, err := user.SetupSingleSigner(ctx, s.Keyring, s.GRPCClient, cdc)
+	if err != nil {
+		return fmt.Errorf("setting up signer: %w", err)
+	}
+	msgs := make([]sdk.Msg, 0, len(balances))
+	for _, balance := range balances {
+		address, err := sdk.AccAddressFromBech32(balance.Address)
+		if err != nil {
 			return err
 		}
+		msgs = append(msgs, banktypes.NewMsgSend(signer.Address(), address, balance.Coins))
 	}
-	return nil
+	// a send to a new account costs less than 100,000 gas
+	gas := uint64(100_000 * (len(msgs) + 1))
+	_, err = signer.SubmitTx(ctx, msgs, user.SetGasLimitAndFee(gas, appconsts.DefaultMinGasPrice))
+	return err
+}
+
+// Stop closes the node's servers, the node and the application. Every one
+// of them is closed even if closing another fails, so that the node always
+// releases its ports and databases.
+func (s *Service) Stop(context.Context) error {
+	errs := make([]error, 0, len(s.closers))
+	for _, closer := range s.closers {
+		errs = append(errs, closer())
+	}
+	// the closers of this run must not be called again by a later stop
+	s.closers = nil
+	return errors.Join(errs...)
 }
@@ -2,7 +2,9 @@ package light
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -13,7 +15,6 @@ import (
 	"github.com/celestiaorg/apollo/node/util"
 	"github.com/celestiaorg/celestia-app/app"
 	"github.com/celestiaorg/celestia-app/app/encoding"
-	"github.com/celestiaorg/celestia-node/libs/utils"
 	"github.com/celestiaorg/celestia-node/nodebuilder"
 	"github.com/celestiaorg/celestia-node/nodebuilder/node"
 	"github.com/celestiaorg/celestia-node/nodebuilder/p2p"
@@ -22,7 +23,13 @@ import (
 	"github.com/tendermint/tendermint/types"
 )
 
-var _ apollo.Service = &Service{}
+var (
+	_ apollo.Service         = &Service{}
+	_ apollo.ConfigReloader  = &Service{}
+	_ apollo.HealthChecker   = &Service{}
+	_ apollo.PortAssigner    = &Service{}
+	_ apollo.LogOutputSetter = &Service{}
+)
 
 const (
 	LightServiceName  = "light-node"
@@ -36,6 +43,26 @@ type Service struct {
 	store   nodebuilder.Store
 	chainID string
 	config  *nodebuilder.Config
+	// logOutput receives the output of celestia-node's loggers
+	logOutput io.Writer
+}
+
+func init() {
+	apollo.RegisterServiceType(LightServiceName, func(_ string, decode func(any) error) (apollo.Service, error) {
+		cfg := DefaultConfig()
+		if err := decode(cfg); err != nil {
+			return nil, err
+		}
+		return New(cfg), nil
+	})
+}
+
+// DefaultConfig returns the configuration of a light node whose RPC can be
+// used without an auth token.
+func DefaultConfig() *nodebuilder.Config {
+	cfg := nodebuilder.DefaultConfig(node.Light)
+	cfg.RPC.SkipAuth = true
+	return cfg
 }
 
 func New(config *nodebuilder.Config) *Service {
@@ -48,6 +75,23 @@ func (s *Service) Name() string {
 	return LightServiceName
 }
 
+// ReloadConfig re-reads the node's config.toml so that changes to it take
+// effect when the node is started again.
+func (s *Service) ReloadConfig(dir string) error {
+	cfg, err := util.ReloadNodeConfig(dir, s.config)
+	if err != nil {
+		return err
+	}
+	s.config = cfg
+	return nil
+}
+
+// AssignPorts takes the ports of the RPC, gateway and P2P servers from the
+// allocator.
+func (s *Service) AssignPorts(ports *apollo.PortAllocator) error {
+	return util.AssignNodePorts(ports, s.config)
+}
+
 func (s *Service) EndpointsNeeded() []string {
 	return []string{consensus.RPCEndpointLabel, consensus.GRPCEndpointLabel, bridge.P2PEndpointLabel}
 }
@@ -62,43 +106,44 @@ func (s *Service) Setup(ctx context.Context, dir string, pendingGenesis *types.G
 	return nil, nodebuilder.Init(*s.config, dir, node.Light)
 }
 
-func (s *Service) Start(ctx context.Context, dir string, genesis *types.GenesisDoc, inputs apollo.Endpoints) (apollo.Endpoints, error) {
-	s.chainID = genesis.ChainID
-	headerHash, err := util.GetTrustedHash(ctx, inputs[consensus.RPCEndpointLabel])
-	if err != nil {
-		return nil, err
-	}
-	s.config.Header.TrustedHash = headerHash
+// SetLogOutput directs the output of celestia-node's loggers to the writer
+// while the node runs. The loggers are shared by all nodes in the process,
+// so the output of other nodes that run at the same time is written to it
+// as well.
+func (s *Service) SetLogOutput(w io.Writer) {
+	s.logOutput = w
+}
 
-	var bridgeAddrInfo peer.AddrInfo
-	if err := bridgeAddrInfo.UnmarshalJSON([]byte(inputs[bridge.P2PEndpointLabel])); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal bridge addr info: %w", err)
+func (s *Service) Start(ctx context.Context, dir string, genesis *types.GenesisDoc, inputs apollo.Endpoints) (apollo.Endpoints, error) {
+	if s.logOutput != nil {
+		util.RouteNodeLogs(LightServiceName, s.logOutput)
 	}
-
-	bridgeAddrs, err := peer.AddrInfoToP2pAddrs(&bridgeAddrInfo)
+	endpoints, err := s.start(ctx, dir, genesis, inputs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert bridge addr info to multiaddrs: %w", err)
+		util.StopNodeLogs(LightServiceName)
 	}
+	return endpoints, err
+}
 
-	// set the trusted peers
-	s.config.Header.TrustedPeers = []string{bridgeAddrs[0].String()}
-	consensusIP, err := utils.ValidateAddr(inputs[consensus.RPCEndpointLabel])
+func (s *Service) start(ctx context.Context, dir string, genesis *types.GenesisDoc, inputs apollo.Endpoints) (apollo.Endpoints, error) {
+	s.chainID = genesis.ChainID
+	headerHash, err := util.GetTrustedHash(ctx, inputs[consensus.RPCEndpointLabel].String())
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse consensus RPC endpoint: %w", err)
+		return nil, err
 	}
-	s.config.Core.IP = consensusIP
+	s.config.Header.TrustedHash = headerHash
 
-	rpcPort, err := util.ParsePort(inputs[consensus.RPCEndpointLabel])
+	bridgeAddr := inputs[bridge.P2PEndpointLabel].Multiaddr()
+	bridgeAddrInfo, err := peer.AddrInfoFromString(bridgeAddr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse consensus RPC endpoint: %w", err)
+		return nil, fmt.Errorf("failed to parse bridge address %s: %w", bridgeAddr, err)
 	}
-	s.config.Core.RPCPort = rpcPort
 
-	grpcPort, err := util.ParsePort(inputs[consensus.GRPCEndpointLabel])
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse consensus GRPC endpoint: %w", err)
+	// set the trusted peers
+	s.config.Header.TrustedPeers = []string{bridgeAddr}
+	if err := util.SetCoreEndpoints(&s.config.Core, inputs[consensus.RPCEndpointLabel], inputs[consensus.GRPCEndpointLabel]); err != nil {
+		return nil, err
 	}
-	s.config.Core.GRPCPort = grpcPort
 
 	encConf := encoding.MakeConfig(app.ModuleEncodingRegisters...)
 
@@ -118,21 +163,37 @@ func (s *Service) Start(ctx context.Context, dir string, genesis *types.GenesisD
 		return nil, err
 	}
 
-	if err := s.node.Host.Connect(ctx, bridgeAddrInfo); err != nil {
+	if err := s.node.Host.Connect(ctx, *bridgeAddrInfo); err != nil {
 		return nil, fmt.Errorf("failed to connect to bridge node: %w", err)
 	}
 
-	endpoints := map[string]string{
-		RPCEndpointLabel:  fmt.Sprintf("http://localhost:%s", s.config.RPC.Port),
-		DocsEndpointLabel: DocsEndpint,
+	rpcEndpoint, err := util.RPCEndpoint(s.config.RPC.Port)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := apollo.Endpoints{
+		RPCEndpointLabel:  rpcEndpoint,
+		DocsEndpointLabel: apollo.MustParseEndpoint(DocsEndpint),
 	}
 
 	return endpoints, s.node.Start(ctx)
 }
 
+// Health reports the node as healthy once it has a local head.
+func (s *Service) Health(ctx context.Context) error {
+	if s.node == nil {
+		return errors.New("node has not been started")
+	}
+	if _, err := s.node.HeaderServ.LocalHead(ctx); err != nil {
+		return fmt.Errorf("getting local head: %w", err)
+	}
+	return nil
+}
+
 func (s *Service) Stop(ctx context.Context) error {
 	if err := s.node.Stop(ctx); err != nil {
 		return err
 	}
+	util.StopNodeLogs(LightServiceName)
 	return s.store.Close()
 }
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	logging "github.com/ipfs/go-log/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// nodeLogs receives the output of celestia-node's loggers. The loggers are
+// shared by every node in the process, so the output is written to the log
+// outputs of all running nodes, or to stderr like before if none is running.
+var nodeLogs = &logRouter{outputs: make(map[string]io.Writer)}
+
+type logRouter struct {
+	once    sync.Once
+	lock    sync.Mutex
+	outputs map[string]io.Writer
+}
+
+// RouteNodeLogs writes the output of celestia-node's loggers to the log
+// output of the named node until StopNodeLogs is called.
+func RouteNodeLogs(name string, w io.Writer) {
+	nodeLogs.once.Do(func() {
+		encoderConfig := zap.NewProductionEncoderConfig()
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		// the levels of the loggers decide what is logged
+		logging.SetPrimaryCore(zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), zapcore.AddSync(nodeLogs), zapcore.DebugLevel))
+	})
+	nodeLogs.lock.Lock()
+	defer nodeLogs.lock.Unlock()
+	nodeLogs.outputs[name] = w
+}
+
+// StopNodeLogs stops writing the output of celestia-node's loggers to the
+// log output of the named node.
+func StopNodeLogs(name string) {
+	nodeLogs.lock.Lock()
+	defer nodeLogs.lock.Unlock()
+	delete(nodeLogs.outputs, name)
+}
+
+func (r *logRouter) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.outputs) == 0 {
+		return os.Stderr.Write(p)
+	}
+	for _, w := range r.outputs {
+		if _, err := w.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
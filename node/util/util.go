@@ -3,9 +3,18 @@ package util
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/celestiaorg/apollo"
+	"github.com/celestiaorg/celestia-node/libs/utils"
+	"github.com/celestiaorg/celestia-node/nodebuilder"
+	"github.com/celestiaorg/celestia-node/nodebuilder/core"
+	"github.com/celestiaorg/celestia-node/nodebuilder/p2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 	rpcclient "github.com/tendermint/tendermint/rpc/client/http"
 )
 
@@ -23,16 +32,144 @@ func GetTrustedHash(ctx context.Context, rpcEndpoint string) (string, error) {
 	return header.Header.Hash().String(), nil
 }
 
-func ParsePort(endpoint string) (string, error) {
-	split := strings.Split(endpoint, ":")
-	if len(split) == 0 {
-		return "", fmt.Errorf("failed to parse port from endpoint: %s", endpoint)
+// AssignP2PPorts replaces the ports of the libp2p listen addresses with
+// ports from the allocator. Addresses that share a port, such as the TCP
+// and QUIC transports, keep sharing the newly allocated port.
+func AssignP2PPorts(ports *apollo.PortAllocator, cfg *p2p.Config) error {
+	assigned := make(map[string]string)
+	replace := func(addrs []string) error {
+		for i, addr := range addrs {
+			maddr, err := ma.NewMultiaddr(addr)
+			if err != nil {
+				return fmt.Errorf("invalid p2p address %s: %w", addr, err)
+			}
+			for _, proto := range []int{ma.P_TCP, ma.P_UDP} {
+				value, err := maddr.ValueForProtocol(proto)
+				if err != nil {
+					continue
+				}
+				port, ok := assigned[value]
+				if !ok {
+					defaultPort, err := strconv.Atoi(value)
+					if err != nil {
+						return fmt.Errorf("invalid port in p2p address %s: %w", addr, err)
+					}
+					newPort, err := ports.Port(defaultPort)
+					if err != nil {
+						return err
+					}
+					port = strconv.Itoa(newPort)
+					assigned[value] = port
+				}
+				name := ma.ProtocolWithCode(proto).Name
+				addr = strings.Replace(addr, fmt.Sprintf("/%s/%s", name, value), fmt.Sprintf("/%s/%s", name, port), 1)
+			}
+			addrs[i] = addr
+		}
+		return nil
 	}
-	port := strings.Split(split[len(split)-1], "/")[0]
+	if err := replace(cfg.ListenAddresses); err != nil {
+		return err
+	}
+	return replace(cfg.NoAnnounceAddresses)
+}
+
+// AssignNodePorts takes the ports of a celestia node's RPC, gateway and P2P
+// servers from the allocator.
+func AssignNodePorts(ports *apollo.PortAllocator, cfg *nodebuilder.Config) error {
+	rpcPort, err := assignPort(ports, cfg.RPC.Port)
+	if err != nil {
+		return fmt.Errorf("assigning RPC port: %w", err)
+	}
+	cfg.RPC.Port = rpcPort
+	if cfg.Gateway.Enabled {
+		gatewayPort, err := assignPort(ports, cfg.Gateway.Port)
+		if err != nil {
+			return fmt.Errorf("assigning gateway port: %w", err)
+		}
+		cfg.Gateway.Port = gatewayPort
+	}
+	return AssignP2PPorts(ports, &cfg.P2P)
+}
 
-	if _, err := strconv.Atoi(port); err != nil {
-		return "", fmt.Errorf("failed to parse port from endpoint: %s", endpoint)
+func assignPort(ports *apollo.PortAllocator, defaultPort string) (string, error) {
+	port, err := strconv.Atoi(defaultPort)
+	if err != nil {
+		return "", fmt.Errorf("invalid port %s: %w", defaultPort, err)
+	}
+	port, err = ports.Port(port)
+	if err != nil {
+		return "", err
 	}
+	return strconv.Itoa(port), nil
+}
 
-	return port, nil
+// ReloadNodeConfig reads the config.toml in a celestia node's directory.
+// The ports that were assigned by Apollo are kept from the current config.
+func ReloadNodeConfig(dir string, current *nodebuilder.Config) (*nodebuilder.Config, error) {
+	cfg, err := nodebuilder.LoadConfig(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		return nil, fmt.Errorf("loading node config: %w", err)
+	}
+	cfg.RPC.Port = current.RPC.Port
+	cfg.Gateway.Port = current.Gateway.Port
+	cfg.P2P.ListenAddresses = current.P2P.ListenAddresses
+	cfg.P2P.NoAnnounceAddresses = current.P2P.NoAnnounceAddresses
+	return cfg, nil
+}
+
+// RPCEndpoint returns the endpoint of a celestia node's RPC server
+// listening on the port.
+func RPCEndpoint(port string) (apollo.Endpoint, error) {
+	rpcPort, err := strconv.Atoi(port)
+	if err != nil {
+		return apollo.Endpoint{}, fmt.Errorf("invalid RPC port %s: %w", port, err)
+	}
+	return apollo.NewEndpoint("http", "localhost", rpcPort), nil
+}
+
+// P2PEndpoint returns a libp2p endpoint that other nodes can connect to the
+// host on. Loopback TCP addresses are preferred as all nodes run on the same
+// machine.
+func P2PEndpoint(h host.Host) (apollo.Endpoint, error) {
+	var endpoint *apollo.Endpoint
+	for _, addr := range h.Addrs() {
+		if _, err := addr.ValueForProtocol(ma.P_TCP); err != nil {
+			continue
+		}
+		parsed, err := apollo.ParseEndpoint(addr.String())
+		if err != nil {
+			continue
+		}
+		if endpoint == nil || manet.IsIPLoopback(addr) {
+			endpoint = &parsed
+		}
+		if manet.IsIPLoopback(addr) {
+			break
+		}
+	}
+	if endpoint == nil {
+		return apollo.Endpoint{}, fmt.Errorf("host has no TCP address")
+	}
+	endpoint.Metadata = map[string]string{apollo.PeerIDKey: h.ID().String()}
+	return *endpoint, nil
+}
+
+// SetCoreEndpoints points a celestia node at the RPC and gRPC endpoints of
+// the consensus node.
+func SetCoreEndpoints(cfg *core.Config, rpcEndpoint, grpcEndpoint apollo.Endpoint) error {
+	consensusIP, err := utils.ValidateAddr(rpcEndpoint.Host)
+	if err != nil {
+		return fmt.Errorf("failed to parse consensus RPC endpoint: %w", err)
+	}
+	cfg.IP = consensusIP
+	if rpcEndpoint.Port == 0 {
+		return fmt.Errorf("consensus RPC endpoint %s has no port", rpcEndpoint)
+	}
+	cfg.RPCPort = strconv.Itoa(rpcEndpoint.Port)
+	if grpcEndpoint.Port == 0 {
+		return fmt.Errorf("consensus GRPC endpoint %s has no port", grpcEndpoint)
+	}
+	cfg.GRPCPort = strconv.Itoa(grpcEndpoint.Port)
+	return nil
 }
@@ -0,0 +1,172 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ServiceName is the full name of the gRPC service defined in plugin.proto.
+const ServiceName = "apollo.plugin.v1.Plugin"
+
+// Info describes a plugin.
+type Info struct {
+	Name              string   `json:"name"`
+	EndpointsNeeded   []string `json:"endpoints_needed"`
+	EndpointsProvided []string `json:"endpoints_provided"`
+}
+
+type SetupRequest struct {
+	Dir string `json:"dir"`
+	// Genesis is the pending genesis document as JSON.
+	Genesis string `json:"genesis"`
+}
+
+type SetupResponse struct {
+	// Accounts are funded in the genesis.
+	Accounts []Account `json:"accounts,omitempty"`
+	// AppState is merged into the state of each module as a JSON merge
+	// patch.
+	AppState map[string]json.RawMessage `json:"app_state,omitempty"`
+}
+
+type Account struct {
+	Address string `json:"address"`
+	// Balance is the amount and denomination, for example "1000utia".
+	Balance string `json:"balance"`
+}
+
+type StartRequest struct {
+	Dir string `json:"dir"`
+	// Genesis is the genesis document as JSON.
+	Genesis   string            `json:"genesis"`
+	Endpoints map[string]string `json:"endpoints"`
+}
+
+type StartResponse struct {
+	Endpoints map[string]string `json:"endpoints"`
+}
+
+// Server is implemented by plugins written in Go.
+type Server interface {
+	Info(context.Context) (*Info, error)
+	Setup(context.Context, *SetupRequest) (*SetupResponse, error)
+	Start(context.Context, *StartRequest) (*StartResponse, error)
+	Stop(context.Context) error
+	Health(context.Context) error
+}
+
+// RegisterServer registers a plugin with a gRPC server.
+func RegisterServer(s *grpc.Server, srv Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Info",
+			Handler: handler("Info", newEmpty, func(srv Server, ctx context.Context, _ *emptypb.Empty) (*structpb.Struct, error) {
+				info, err := srv.Info(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return toStruct(info)
+			}),
+		},
+		{
+			MethodName: "Setup",
+			Handler: handler("Setup", newStruct, func(srv Server, ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+				var req SetupRequest
+				if err := fromStruct(in, &req); err != nil {
+					return nil, err
+				}
+				resp, err := srv.Setup(ctx, &req)
+				if err != nil {
+					return nil, err
+				}
+				return toStruct(resp)
+			}),
+		},
+		{
+			MethodName: "Start",
+			Handler: handler("Start", newStruct, func(srv Server, ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+				var req StartRequest
+				if err := fromStruct(in, &req); err != nil {
+					return nil, err
+				}
+				resp, err := srv.Start(ctx, &req)
+				if err != nil {
+					return nil, err
+				}
+				return toStruct(resp)
+			}),
+		},
+		{
+			MethodName: "Stop",
+			Handler: handler("Stop", newEmpty, func(srv Server, ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+				return &emptypb.Empty{}, srv.Stop(ctx)
+			}),
+		},
+		{
+			MethodName: "Health",
+			Handler: handler("Health", newEmpty, func(srv Server, ctx context.Context, _ *emptypb.Empty) (*emptypb.Empty, error) {
+				return &emptypb.Empty{}, srv.Health(ctx)
+			}),
+		},
+	},
+	Metadata: "plugin/plugin.proto",
+}
+
+func newEmpty() *emptypb.Empty    { return &emptypb.Empty{} }
+func newStruct() *structpb.Struct { return &structpb.Struct{} }
+
+// handler adapts a call of the Server to a gRPC method handler.
+func handler[Req, Resp proto.Message](method string, newReq func() Req, call func(Server, context.Context, Req) (Resp, error)) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		in := newReq()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		invoke := func(ctx context.Context, req any) (any, error) {
+			return call(srv.(Server), ctx, req.(Req))
+		}
+		if interceptor == nil {
+			return invoke(ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod(method)}
+		return interceptor(ctx, in, info, invoke)
+	}
+}
+
+func fullMethod(method string) string {
+	return "/" + ServiceName + "/" + method
+}
+
+// toStruct converts a message to a Struct through its JSON encoding.
+func toStruct(v any) (*structpb.Struct, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	s := &structpb.Struct{}
+	if err := protojson.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// fromStruct converts a Struct to a message through its JSON encoding.
+func fromStruct(s *structpb.Struct, v any) error {
+	data, err := protojson.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,470 @@
+// Package plugin runs services out of process over a gRPC protocol that
+// mirrors the Service interface, defined in plugin.proto. Plugins can be
+// written in any language or built against other versions of celestia-app,
+// and unlike processes run with the exec service, they can change the
+// genesis of the network during setup.
+//
+// A plugin is either already running at a known address, or launched by
+// Apollo from a command, in which case it must serve the protocol on the
+// address in the APOLLO_PLUGIN_ADDRESS environment variable. A launched
+// plugin is run briefly when it is loaded to describe itself and again for
+// the setup of the service, and runs from the start of the service until it
+// is stopped.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/celestiaorg/apollo"
+	"github.com/celestiaorg/apollo/exec"
+	"github.com/celestiaorg/apollo/genesis"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	tmjson "github.com/tendermint/tendermint/libs/json"
+	"github.com/tendermint/tendermint/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	_ apollo.Service         = &Service{}
+	_ apollo.HealthChecker   = &Service{}
+	_ apollo.FailureNotifier = &Service{}
+	_ apollo.LogOutputSetter = &Service{}
+)
+
+const (
+	// ServiceType is the type under which plugins are registered, for use
+	// in network definitions.
+	ServiceType = "plugin"
+	// AddressEnv is the environment variable that holds the address a
+	// launched plugin must serve the protocol on.
+	AddressEnv = "APOLLO_PLUGIN_ADDRESS"
+	// DefaultConnectTimeout is how long a plugin has to start serving the
+	// protocol.
+	DefaultConnectTimeout = 10 * time.Second
+)
+
+func init() {
+	apollo.RegisterServiceType(ServiceType, func(name string, decode func(any) error) (apollo.Service, error) {
+		cfg := DefaultConfig()
+		if err := decode(cfg); err != nil {
+			return nil, err
+		}
+		return New(context.Background(), name, cfg)
+	})
+}
+
+type Config struct {
+	// Address is the address of a plugin that is already running. Either
+	// it or the Command must be set.
+	Address string `toml:"address"`
+	// Command, Args and Env launch the plugin.
+	Command string            `toml:"command"`
+	Args    []string          `toml:"args"`
+	Env     map[string]string `toml:"env"`
+	// ConnectTimeout is how long the plugin has to start serving the
+	// protocol.
+	ConnectTimeout time.Duration `toml:"connect_timeout"`
+	// StopTimeout is how long a launched plugin is given to exit after
+	// SIGTERM before it is killed.
+	StopTimeout time.Duration `toml:"stop_timeout"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		ConnectTimeout: DefaultConnectTimeout,
+		StopTimeout:    exec.DefaultStopTimeout,
+	}
+}
+
+// Service drives a plugin through the plugin protocol.
+type Service struct {
+	name   string
+	config *Config
+	info   Info
+	logs   *logWriter
+
+	lock    sync.Mutex
+	conn    *grpc.ClientConn
+	process *exec.Service
+}
+
+// New loads a plugin and asks it to describe itself, launching it for as
+// long as that takes if needed. The service takes the name of the plugin
+// unless name is set.
+func New(ctx context.Context, name string, config *Config) (*Service, error) {
+	if (config.Address == "") == (config.Command == "") {
+		return nil, errors.New("either an address or a command must be set")
+	}
+	s := &Service{
+		name:   name,
+		config: config,
+		logs:   &logWriter{w: os.Stdout},
+	}
+	if err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+	out := &structpb.Struct{}
+	err := s.invoke(ctx, "Info", &emptypb.Empty{}, out)
+	if err == nil {
+		if err = fromStruct(out, &s.info); err != nil {
+			err = fmt.Errorf("invalid plugin info: %w", err)
+		}
+	}
+	if err := errors.Join(err, s.disconnect(ctx)); err != nil {
+		return nil, err
+	}
+	if s.name == "" {
+		s.name = s.info.Name
+	}
+	if s.name == "" {
+		return nil, errors.New("plugin has no name")
+	}
+	return s, nil
+}
+
+func (s *Service) Name() string {
+	return s.name
+}
+
+func (s *Service) EndpointsNeeded() []string {
+	return s.info.EndpointsNeeded
+}
+
+func (s *Service) EndpointsProvided() []string {
+	return s.info.EndpointsProvided
+}
+
+// SetLogOutput directs the output of a launched plugin to the writer.
+func (s *Service) SetLogOutput(w io.Writer) {
+	s.logs.set(w)
+}
+
+// Setup sets up the plugin's service. A launched plugin is stopped again
+// once it has been set up.
+func (s *Service) Setup(ctx context.Context, dir string, pendingGenesis *types.GenesisDoc) (genesis.Modifier, error) {
+	if err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+	modifier, err := s.setup(ctx, dir, pendingGenesis)
+	if s.config.Command != "" {
+		err = errors.Join(err, s.disconnect(ctx))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return modifier, nil
+}
+
+func (s *Service) setup(ctx context.Context, dir string, pendingGenesis *types.GenesisDoc) (genesis.Modifier, error) {
+	genesisJSON, err := tmjson.Marshal(pendingGenesis)
+	if err != nil {
+		return nil, err
+	}
+	var resp SetupResponse
+	if err := s.call(ctx, "Setup", &SetupRequest{Dir: dir, Genesis: string(genesisJSON)}, &resp); err != nil {
+		return nil, err
+	}
+	return genesisModifier(&resp, pendingGenesis.AppState, s.logs)
+}
+
+// Start starts the plugin's service, launching the plugin if needed. The
+// plugin is stopped again if its service fails to start.
+func (s *Service) Start(ctx context.Context, dir string, genesis *types.GenesisDoc, inputs apollo.Endpoints) (apollo.Endpoints, error) {
+	if err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+	endpoints, err := s.start(ctx, dir, genesis, inputs)
+	if err != nil {
+		return nil, errors.Join(err, s.disconnect(ctx))
+	}
+	return endpoints, nil
+}
+
+func (s *Service) start(ctx context.Context, dir string, genesis *types.GenesisDoc, inputs apollo.Endpoints) (apollo.Endpoints, error) {
+	genesisJSON, err := tmjson.Marshal(genesis)
+	if err != nil {
+		return nil, err
+	}
+	req := &StartRequest{Dir: dir, Genesis: string(genesisJSON), Endpoints: make(map[string]string, len(inputs))}
+	for name, endpoint := range inputs {
+		req.Endpoints[name] = endpoint.String()
+	}
+	var resp StartResponse
+	if err := s.call(ctx, "Start", req, &resp); err != nil {
+		return nil, err
+	}
+	endpoints := make(apollo.Endpoints, len(resp.Endpoints))
+	for name, value := range resp.Endpoints {
+		endpoint, err := apollo.ParseEndpoint(value)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %s: %w", name, err)
+		}
+		endpoints[name] = endpoint
+	}
+	return endpoints, nil
+}
+
+// Health asks the plugin whether its service is ready.
+func (s *Service) Health(ctx context.Context) error {
+	return s.invoke(ctx, "Health", &emptypb.Empty{}, &emptypb.Empty{})
+}
+
+// Failed returns a channel that receives an error if a launched plugin
+// exits without being stopped.
+func (s *Service) Failed() <-chan error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.process == nil {
+		return nil
+	}
+	return s.process.Failed()
+}
+
+// Stop stops the plugin's service and, if it was launched by Apollo, the
+// plugin itself.
+func (s *Service) Stop(ctx context.Context) error {
+	err := s.invoke(ctx, "Stop", &emptypb.Empty{}, &emptypb.Empty{})
+	if s.config.Command != "" {
+		return errors.Join(err, s.disconnect(ctx))
+	}
+	return err
+}
+
+// connect launches the plugin if needed and connects to it.
+func (s *Service) connect(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn != nil {
+		return nil
+	}
+
+	address := s.config.Address
+	if s.config.Command != "" {
+		var err error
+		address, err = freeAddress()
+		if err != nil {
+			return err
+		}
+		env := map[string]string{AddressEnv: address}
+		for name, value := range s.config.Env {
+			env[name] = value
+		}
+		name := s.name
+		if name == "" {
+			name = ServiceType
+		}
+		process, err := exec.New(name, &exec.Config{
+			Command:     s.config.Command,
+			Args:        s.config.Args,
+			Env:         env,
+			StopTimeout: s.config.StopTimeout,
+		})
+		if err != nil {
+			return err
+		}
+		process.SetLogOutput(s.logs)
+		if _, err := process.Start(ctx, "", nil, nil); err != nil {
+			return fmt.Errorf("launching plugin: %w", err)
+		}
+		s.process = process
+	}
+
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return s.stopProcess(ctx, err)
+	}
+	// wait for the plugin to start serving
+	connectCtx, cancel := context.WithTimeout(ctx, s.config.ConnectTimeout)
+	defer cancel()
+	if err := conn.Invoke(connectCtx, fullMethod("Health"), &emptypb.Empty{}, &emptypb.Empty{}, grpc.WaitForReady(true)); err != nil && connectCtx.Err() != nil {
+		conn.Close()
+		return s.stopProcess(ctx, fmt.Errorf("connecting to plugin at %s: %w", address, connectCtx.Err()))
+	}
+	s.conn = conn
+	return nil
+}
+
+// disconnect closes the connection to the plugin and stops it if it was
+// launched.
+func (s *Service) disconnect(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return s.stopProcess(ctx, nil)
+}
+
+// stopProcess stops a launched plugin and joins any error to err. The lock
+// must be held.
+func (s *Service) stopProcess(ctx context.Context, err error) error {
+	if s.process == nil {
+		return err
+	}
+	stopErr := s.process.Stop(ctx)
+	s.process = nil
+	return errors.Join(err, stopErr)
+}
+
+// call invokes a method with a request and response that are converted to
+// and from Structs.
+func (s *Service) call(ctx context.Context, method string, req, resp any) error {
+	in, err := toStruct(req)
+	if err != nil {
+		return err
+	}
+	out := &structpb.Struct{}
+	if err := s.invoke(ctx, method, in, out); err != nil {
+		return err
+	}
+	if err := fromStruct(out, resp); err != nil {
+		return fmt.Errorf("invalid response to %s: %w", method, err)
+	}
+	return nil
+}
+
+func (s *Service) invoke(ctx context.Context, method string, in, out any) error {
+	s.lock.Lock()
+	conn := s.conn
+	s.lock.Unlock()
+	if conn == nil {
+		return errors.New("plugin is not running")
+	}
+	if err := conn.Invoke(ctx, fullMethod(method), in, out); err != nil {
+		return fmt.Errorf("plugin %s: %w", method, err)
+	}
+	return nil
+}
+
+// genesisModifier turns the genesis changes of a plugin into a modifier.
+// The changes to the app state are tried on that of the pending genesis so
+// that a patch that can't be merged fails the setup of the plugin. If the
+// modifier still fails to merge a patch, the module is left unchanged and
+// the error is written to logs.
+func genesisModifier(resp *SetupResponse, pendingAppState json.RawMessage, logs io.Writer) (genesis.Modifier, error) {
+	pending := make(map[string]json.RawMessage)
+	if len(pendingAppState) > 0 {
+		if err := json.Unmarshal(pendingAppState, &pending); err != nil {
+			return nil, fmt.Errorf("invalid app state of the pending genesis: %w", err)
+		}
+	}
+	var modifiers []genesis.Modifier
+	cdc := apollo.Codec().Codec
+	for _, account := range resp.Accounts {
+		address, err := sdk.AccAddressFromBech32(account.Address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid account address %q: %w", account.Address, err)
+		}
+		balance, err := sdk.ParseCoinNormalized(account.Balance)
+		if err != nil {
+			return nil, fmt.Errorf("invalid balance %q for account %s: %w", account.Balance, account.Address, err)
+		}
+		modifiers = append(modifiers, genesis.FundAccounts(cdc, []sdk.AccAddress{address}, balance))
+	}
+	for module, patch := range resp.AppState {
+		if !json.Valid(patch) {
+			return nil, fmt.Errorf("invalid app state of module %s", module)
+		}
+		if _, err := mergePatch(pending[module], patch); err != nil {
+			return nil, fmt.Errorf("merging app state of module %s: %w", module, err)
+		}
+		module, patch := module, patch
+		modifiers = append(modifiers, func(state map[string]json.RawMessage) map[string]json.RawMessage {
+			merged, err := mergePatch(state[module], patch)
+			if err != nil {
+				fmt.Fprintf(logs, "failed to merge app state of module %s, leaving it unchanged: %s\n", module, err)
+				return state
+			}
+			state[module] = merged
+			return state
+		})
+	}
+	return func(state map[string]json.RawMessage) map[string]json.RawMessage {
+		for _, modifier := range modifiers {
+			state = modifier(state)
+		}
+		return state
+	}, nil
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386) to a document.
+func mergePatch(doc, patch json.RawMessage) (json.RawMessage, error) {
+	var target, changes any
+	if len(doc) > 0 {
+		if err := unmarshal(doc, &target); err != nil {
+			return nil, err
+		}
+	}
+	if err := unmarshal(patch, &changes); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(target, changes))
+}
+
+func merge(target, patch any) any {
+	changes, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	fields, ok := target.(map[string]any)
+	if !ok {
+		fields = make(map[string]any)
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(fields, name)
+			continue
+		}
+		fields[name] = merge(fields[name], value)
+	}
+	return fields
+}
+
+// unmarshal decodes JSON keeping numbers as they are.
+func unmarshal(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// freeAddress returns a local address with a port that is currently free.
+func freeAddress() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("finding a free port for the plugin: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String(), nil
+}
+
+// logWriter passes writes on to a writer that can be replaced, since a
+// plugin may be launched before the Conductor sets its log output.
+type logWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (l *logWriter) set(w io.Writer) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.w = w
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,165 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/celestiaorg/apollo"
+	"github.com/celestiaorg/apollo/genesis"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// testPlugin funds an account, changes the blob parameters and provides an
+// endpoint derived from the one it needs.
+type testPlugin struct {
+	started bool
+}
+
+func (p *testPlugin) Info(context.Context) (*Info, error) {
+	return &Info{
+		Name:              "test-plugin",
+		EndpointsNeeded:   []string{"bridge-rpc"},
+		EndpointsProvided: []string{"rollup-rpc"},
+	}, nil
+}
+
+func (p *testPlugin) Setup(_ context.Context, req *SetupRequest) (*SetupResponse, error) {
+	if req.Genesis == "" {
+		return nil, errors.New("no genesis")
+	}
+	return &SetupResponse{
+		Accounts: []Account{{Address: "celestia1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqzf30as", Balance: "1000utia"}},
+		AppState: map[string]json.RawMessage{
+			"blob": json.RawMessage(`{"params": {"gov_max_square_size": "128"}}`),
+		},
+	}, nil
+}
+
+func (p *testPlugin) Start(_ context.Context, req *StartRequest) (*StartResponse, error) {
+	p.started = true
+	return &StartResponse{Endpoints: map[string]string{"rollup-rpc": req.Endpoints["bridge-rpc"] + "/rollup"}}, nil
+}
+
+func (p *testPlugin) Stop(context.Context) error {
+	p.started = false
+	return nil
+}
+
+func (p *testPlugin) Health(context.Context) error {
+	if !p.started {
+		return errors.New("not started")
+	}
+	return nil
+}
+
+// serve serves the test plugin on the listener until the test ends.
+func serve(t testing.TB, listener net.Listener) {
+	server := grpc.NewServer()
+	RegisterServer(server, &testPlugin{})
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+}
+
+// TestMain lets the test binary run as a launched plugin.
+func TestMain(m *testing.M) {
+	if address := os.Getenv(AddressEnv); address != "" {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			os.Exit(1)
+		}
+		server := grpc.NewServer()
+		RegisterServer(server, &testPlugin{})
+		_ = server.Serve(listener)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func testLifecycle(t *testing.T, service *Service) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	require.Equal(t, []string{"bridge-rpc"}, service.EndpointsNeeded())
+	require.Equal(t, []string{"rollup-rpc"}, service.EndpointsProvided())
+
+	gen := genesis.NewDefaultGenesis()
+	pending, err := gen.Export()
+	require.NoError(t, err)
+	modifier, err := service.Setup(ctx, t.TempDir(), pending)
+	require.NoError(t, err)
+	doc, err := gen.WithModifiers(modifier).Export()
+	require.NoError(t, err)
+	var appState map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(doc.AppState, &appState))
+	require.Contains(t, string(appState["bank"]), "celestia1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqzf30as")
+	require.JSONEq(t, `{"params": {"gas_per_blob_byte": 8, "gov_max_square_size": "128"}}`, string(appState["blob"]))
+
+	require.Error(t, service.Health(ctx))
+	endpoints, err := service.Start(ctx, t.TempDir(), doc, apollo.Endpoints{"bridge-rpc": apollo.NewEndpoint("http", "localhost", 26658)})
+	require.NoError(t, err)
+	require.Equal(t, apollo.Endpoints{"rollup-rpc": apollo.MustParseEndpoint("http://localhost:26658/rollup")}, endpoints)
+	require.NoError(t, service.Health(ctx))
+	require.NoError(t, service.Stop(ctx))
+}
+
+func TestPluginAtAddress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serve(t, listener)
+
+	cfg := DefaultConfig()
+	cfg.Address = listener.Addr().String()
+	service, err := New(context.Background(), "", cfg)
+	require.NoError(t, err)
+	require.Equal(t, "test-plugin", service.Name())
+	testLifecycle(t, service)
+}
+
+func TestLaunchedPlugin(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Command = os.Args[0]
+	service, err := New(context.Background(), "rollup", cfg)
+	require.NoError(t, err)
+	require.Equal(t, "rollup", service.Name())
+	require.Nil(t, service.Failed(), "plugin should not be running once it has been loaded")
+	service.SetLogOutput(os.Stderr)
+	testLifecycle(t, service)
+	require.Nil(t, service.Failed(), "plugin should not be running after it was stopped")
+}
+
+func TestMergePatch(t *testing.T) {
+	merged, err := mergePatch(
+		json.RawMessage(`{"a": {"b": 1, "c": 2}, "d": 12345678901234567890}`),
+		json.RawMessage(`{"a": {"b": null, "e": [3]}, "f": "g"}`),
+	)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"a": {"c": 2, "e": [3]}, "d": 12345678901234567890, "f": "g"}`, string(merged))
+}
+
+func TestGenesisModifier(t *testing.T) {
+	resp := &SetupResponse{AppState: map[string]json.RawMessage{"blob": json.RawMessage(`{"params": {"gas_per_blob_byte": 8}}`)}}
+	_, err := genesisModifier(resp, json.RawMessage(`{"blob": `), io.Discard)
+	require.ErrorContains(t, err, "invalid app state of the pending genesis")
+
+	modifier, err := genesisModifier(resp, json.RawMessage(`{"blob": {"params": {"gas_per_blob_byte": 1}}}`), io.Discard)
+	require.NoError(t, err)
+	state := modifier(map[string]json.RawMessage{"blob": json.RawMessage(`{"params": {"gas_per_blob_byte": 1, "gov_max_square_size": "64"}}`)})
+	require.JSONEq(t, `{"params": {"gas_per_blob_byte": 8, "gov_max_square_size": "64"}}`, string(state["blob"]))
+
+	// a patch that can't be merged leaves the module unchanged instead of
+	// crashing the export of the genesis
+	var logs bytes.Buffer
+	modifier, err = genesisModifier(resp, nil, &logs)
+	require.NoError(t, err)
+	state = modifier(map[string]json.RawMessage{"blob": json.RawMessage(`{"params": `)})
+	require.Equal(t, `{"params": `, string(state["blob"]))
+	require.Contains(t, logs.String(), "failed to merge app state of module blob")
+}
@@ -0,0 +1,143 @@
+package apollo
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PortAllocator hands out the ports that services listen on. By default
+// services keep their usual ports. An offset shifts every port by the same
+// amount, which allows a few networks to run side by side with predictable
+// ports, while random allocation picks any free port, which allows any
+// number of networks to run at once, for example in parallel tests. A port
+// is never handed out twice by the same allocator.
+type PortAllocator struct {
+	lock     sync.Mutex
+	offset   int
+	random   bool
+	assigned map[int]struct{}
+}
+
+func NewPortAllocator() *PortAllocator {
+	return &PortAllocator{assigned: make(map[int]struct{})}
+}
+
+// WithOffset shifts every port that is handed out by the offset.
+func (a *PortAllocator) WithOffset(offset int) *PortAllocator {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.offset = offset
+	return a
+}
+
+// WithRandomPorts makes the allocator hand out free ports chosen by the
+// operating system instead of the default ports.
+func (a *PortAllocator) WithRandomPorts() *PortAllocator {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.random = true
+	return a
+}
+
+// Port returns the port to use in place of the default port. A default
+// port of 0 always results in a free port.
+func (a *PortAllocator) Port(defaultPort int) (int, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.random || defaultPort == 0 {
+		for {
+			port, err := freePort()
+			if err != nil {
+				return 0, err
+			}
+			if _, ok := a.assigned[port]; !ok {
+				a.assigned[port] = struct{}{}
+				return port, nil
+			}
+		}
+	}
+
+	port := defaultPort + a.offset
+	// services that share a default port get consecutive ports
+	for {
+		if port <= 0 || port > 65535 {
+			return 0, fmt.Errorf("port %d shifted by %d is out of range", defaultPort, a.offset)
+		}
+		if _, ok := a.assigned[port]; !ok {
+			a.assigned[port] = struct{}{}
+			return port, nil
+		}
+		port++
+	}
+}
+
+// Address replaces the port of an address of the form "host:port", with
+// an optional scheme such as "tcp://", with an allocated port.
+func (a *PortAllocator) Address(address string) (string, error) {
+	scheme, hostPort := "", address
+	if i := strings.Index(address, "://"); i >= 0 {
+		scheme, hostPort = address[:i+3], address[i+3:]
+	}
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return "", fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	defaultPort, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", fmt.Errorf("invalid port in address %q: %w", address, err)
+	}
+	port, err := a.Port(defaultPort)
+	if err != nil {
+		return "", err
+	}
+	return scheme + net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// freePort asks the operating system for a port that is currently free.
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("finding a free port: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// WithPortAllocator sets the allocator that assigns ports to services and
+// the control panel.
+func (c *Conductor) WithPortAllocator(ports *PortAllocator) *Conductor {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.ports = ports
+	return c
+}
+
+// assignPorts lets every service that implements PortAssigner choose its
+// ports. Services are visited in their start order so that ports are
+// assigned deterministically. Ports are only assigned once per Conductor.
+// The caller must hold the operation lock.
+func (c *Conductor) assignPorts() error {
+	if c.portsAssigned {
+		return nil
+	}
+	c.lock.RLock()
+	ports := c.ports
+	c.lock.RUnlock()
+	for _, layer := range c.layers {
+		for _, name := range layer {
+			assigner, ok := c.services[name].(PortAssigner)
+			if !ok {
+				continue
+			}
+			if err := assigner.AssignPorts(ports); err != nil {
+				return fmt.Errorf("failed to assign ports to service %s: %w", name, err)
+			}
+		}
+	}
+	c.portsAssigned = true
+	return nil
+}
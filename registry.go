@@ -0,0 +1,63 @@
+package apollo
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ServiceFactory creates a service from its configuration. name is the name
+// the service is given in the network definition, which services of a type
+// that can run more than once use as their own name. decode decodes
+// the service's section of the network definition into the value it is
+// given, which should be a pointer to the service's configuration filled in
+// with its defaults. Keys that are missing from the section keep their
+// default values.
+type ServiceFactory func(name string, decode func(v any) error) (Service, error)
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]ServiceFactory)
+)
+
+// RegisterServiceType makes a type of service available to be enabled from
+// a network definition. It is meant to be called from the init function of
+// the package implementing the service. Registering the same type twice
+// panics.
+func RegisterServiceType(name string, factory ServiceFactory) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if factory == nil {
+		panic("apollo: registering nil factory for service type " + name)
+	}
+	if _, ok := registry[name]; ok {
+		panic("apollo: service type " + name + " is registered twice")
+	}
+	registry[name] = factory
+}
+
+// NewServiceOfType creates a service of a registered type under the given
+// name. decode decodes the configuration of the service as described by
+// ServiceFactory.
+func NewServiceOfType(serviceType, name string, decode func(v any) error) (Service, error) {
+	registryLock.RLock()
+	factory, ok := registry[serviceType]
+	registryLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown service type %q (registered types: %v)", serviceType, ServiceTypes())
+	}
+	return factory(name, decode)
+}
+
+// ServiceTypes returns the names of all registered types of services in
+// alphabetical order.
+func ServiceTypes() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,97 @@
+package apollo
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+)
+
+// RestartOption changes how services are restarted.
+type RestartOption func(*restartOptions)
+
+type restartOptions struct {
+	reloadConfig bool
+}
+
+// WithConfigReload makes services that implement ConfigReloader re-read
+// their configuration while they are stopped.
+func WithConfigReload() RestartOption {
+	return func(o *restartOptions) {
+		o.reloadConfig = true
+	}
+}
+
+func newRestartOptions(opts []RestartOption) restartOptions {
+	var options restartOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// RestartService stops a service together with the running services that
+// depend on it and starts them all again. Their directories are kept, and
+// the dependents receive the endpoints that the service provides after it
+// has been restarted. A service that isn't running is simply started.
+func (c *Conductor) RestartService(ctx context.Context, name string, opts ...RestartOption) error {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+
+	if _, ok := c.services[name]; !ok {
+		return fmt.Errorf("service %s does not exist", name)
+	}
+	options := newRestartOptions(opts)
+
+	restart := map[string]bool{name: true}
+	for dependent := range closure(name, dependents(c.deps)) {
+		if c.isStoppable(dependent) {
+			restart[dependent] = true
+		}
+	}
+	c.logger.Printf("restarting service %s", name)
+	if err := c.stopSelected(ctx, restart); err != nil {
+		return err
+	}
+	if options.reloadConfig {
+		if err := c.reloadConfig(restart); err != nil {
+			return err
+		}
+	}
+	return c.startSelected(ctx, restart)
+}
+
+// Restart stops all running services and starts them again, keeping their
+// directories. Services that were stopped stay stopped.
+func (c *Conductor) Restart(ctx context.Context, opts ...RestartOption) error {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+
+	options := newRestartOptions(opts)
+	c.logger.Printf("restarting all services")
+	running := c.runningServices()
+	if err := c.stop(ctx); err != nil {
+		return err
+	}
+	if options.reloadConfig {
+		if err := c.reloadConfig(running); err != nil {
+			return err
+		}
+	}
+	return c.startSelected(ctx, running)
+}
+
+// reloadConfig asks the selected services that implement ConfigReloader to
+// re-read their configuration.
+func (c *Conductor) reloadConfig(selected map[string]bool) error {
+	for name := range selected {
+		reloader, ok := c.services[name].(ConfigReloader)
+		if !ok {
+			continue
+		}
+		if err := reloader.ReloadConfig(filepath.Join(c.rootDir, name)); err != nil {
+			return fmt.Errorf("failed to reload config of service %s: %w", name, err)
+		}
+		c.logService(name, "reloaded config")
+	}
+	return nil
+}
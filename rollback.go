@@ -0,0 +1,102 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// StartupReportFile is the name of the file within the Apollo directory
+// that describes why the network last failed to start, when the directory
+// already existed and was kept.
+const StartupReportFile = "startup-failure.json"
+
+// StartupReport is written by Rollback when a network that already had
+// state fails to start.
+type StartupReport struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+	// Removed are the directories that were created by the failed run and
+	// have been deleted again.
+	Removed []string `json:"removed,omitempty"`
+	// Services is the status of each service when startup failed.
+	Services map[string]Status `json:"services"`
+}
+
+// trackNewDir records a directory that is about to be created in this run
+// so that Rollback can delete it again. The caller must hold the operation
+// lock.
+func (c *Conductor) trackNewDir(dir string) {
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		c.created = append(c.created, dir)
+	}
+}
+
+// Rollback undoes a run that failed to set up or start the network. It
+// stops the services that were already started and deletes the directories
+// that were created in this run. If the whole root directory was created,
+// it is removed entirely. Otherwise existing state is never deleted and a
+// StartupReport describing the failure is written to the root directory.
+// Nothing is rolled back unless the Conductor holds the lock on the root
+// directory.
+func (c *Conductor) Rollback(ctx context.Context, cause error) error {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+
+	if c.lockFile == nil {
+		// the directory is in use by another process, or this run didn't
+		// get as far as changing it
+		return nil
+	}
+	report := StartupReport{
+		Time:     time.Now(),
+		Error:    cause.Error(),
+		Services: c.ServiceStatus(),
+	}
+	c.logger.Printf("rolling back failed startup: %s", cause.Error())
+	if err := c.stop(ctx); err != nil {
+		// services that are still running may be using their
+		// directories, so nothing is deleted
+		err = fmt.Errorf("failed to stop services: %w", err)
+		report.Error += "\n" + err.Error()
+		return errors.Join(err, c.writeStartupReport(report))
+	}
+	c.closeLogs()
+
+	if slices.Contains(c.created, c.rootDir) {
+		c.logger.Printf("removing %s which was created by this run", c.rootDir)
+		c.created = nil
+		return errors.Join(c.releaseLock(), os.RemoveAll(c.rootDir))
+	}
+	var errs []error
+	for _, dir := range c.created {
+		c.logger.Printf("removing %s which was created by this run", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		report.Removed = append(report.Removed, dir)
+	}
+	c.created = nil
+
+	errs = append(errs, c.writeStartupReport(report))
+	return errors.Join(errs...)
+}
+
+func (c *Conductor) writeStartupReport(report StartupReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(c.rootDir, StartupReportFile)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write startup report: %w", err)
+	}
+	c.logger.Printf("kept the state at %s, see %s for details of the failure", c.rootDir, path)
+	return nil
+}
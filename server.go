@@ -0,0 +1,118 @@
+package apollo
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultListenAddress is the address the control panel listens on
+	// unless another is configured.
+	DefaultListenAddress = "0.0.0.0:8080"
+	// PanelAddressFile is the name of the file within the Apollo directory
+	// that the URL of the control panel is written to while it is served.
+	PanelAddressFile = "panel-address"
+)
+
+// ServerConfig configures the control panel server started by Serve.
+type ServerConfig struct {
+	// ListenAddress is the host and port the server listens on. Use port 0
+	// to pick any free port.
+	ListenAddress string
+	// FixedPort makes the server listen on the port of ListenAddress as it
+	// is, instead of shifting it with the PortAllocator of the Conductor.
+	FixedPort bool
+	// ReadTimeout is the maximum duration for reading an entire request.
+	// Zero means no timeout.
+	ReadTimeout time.Duration
+	// WriteTimeout is the maximum duration before timing out writes of a
+	// response. It does not apply to the streaming /events and followed
+	// /logs endpoints. Zero means no timeout. Note that starting a service
+	// can take as long as its start timeout.
+	WriteTimeout time.Duration
+	// TLSCertFile and TLSKeyFile are the paths to a certificate and its
+	// private key. If both are set, the server is served over HTTPS.
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// DefaultServerConfig returns the configuration used for the control panel
+// unless another is provided.
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		ListenAddress: DefaultListenAddress,
+		ReadTimeout:   10 * time.Second,
+	}
+}
+
+// TLS returns true if the server is configured to use TLS.
+func (cfg ServerConfig) TLS() bool {
+	return cfg.TLSCertFile != "" || cfg.TLSKeyFile != ""
+}
+
+func (cfg ServerConfig) Validate() error {
+	if cfg.ListenAddress == "" {
+		return fmt.Errorf("listen address must be set")
+	}
+	if _, _, err := net.SplitHostPort(cfg.ListenAddress); err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", cfg.ListenAddress, err)
+	}
+	if cfg.ReadTimeout < 0 || cfg.WriteTimeout < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+	if cfg.TLS() && (cfg.TLSCertFile == "" || cfg.TLSKeyFile == "") {
+		return fmt.Errorf("both a TLS certificate and key must be provided")
+	}
+	return nil
+}
+
+// WithServerConfig sets the configuration of the control panel server.
+func (c *Conductor) WithServerConfig(cfg ServerConfig) *Conductor {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.serverConfig = cfg
+	return c
+}
+
+// panelURL returns the URL clients can use to reach a server listening on
+// the given address. Unspecified hosts are replaced with localhost.
+func panelURL(addr net.Addr, tls bool) string {
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return fmt.Sprintf("%s://%s", scheme, addr.String())
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, port))
+}
+
+// ReadPanelAddress returns the URL of the control panel that is currently
+// served for the Apollo directory.
+func ReadPanelAddress(dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, PanelAddressFile))
+	if err != nil {
+		return "", fmt.Errorf("reading control panel address: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func writePanelAddress(dir, url string) error {
+	return os.WriteFile(filepath.Join(dir, PanelAddressFile), []byte(url+"\n"), 0o644)
+}
+
+// disableWriteTimeout lifts the server's write timeout for long-lived
+// streaming responses.
+func disableWriteTimeout(w http.ResponseWriter) {
+	// not all writers support deadlines, in which case there is nothing to lift
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
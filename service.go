@@ -3,10 +3,12 @@ package apollo
 import (
 	"context"
 	"fmt"
+	"io"
 
 	"github.com/celestiaorg/apollo/genesis"
 	"github.com/celestiaorg/celestia-app/app"
 	"github.com/celestiaorg/celestia-app/app/encoding"
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
 	"github.com/tendermint/tendermint/types"
 )
 
@@ -27,7 +29,68 @@ type Service interface {
 	Stop(context.Context) error
 }
 
-type Endpoints map[string]string
+// HealthChecker is an optional interface that services can implement to
+// report whether they are ready to serve requests. After a service has
+// started, the Conductor polls Health until it returns no error before
+// publishing the service's endpoints, and then continues to probe it
+// periodically for as long as the service is running.
+type HealthChecker interface {
+	Health(context.Context) error
+}
+
+// FailureNotifier is an optional interface for services that can detect
+// when they have stopped unexpectedly after starting. Failed is called
+// after every successful Start and the Conductor treats any error received,
+// or the channel being closed, as a crash and restarts the service
+// according to its RestartPolicy.
+type FailureNotifier interface {
+	Failed() <-chan error
+}
+
+// LogOutputSetter is an optional interface for services that can direct
+// their logs to a writer. The Conductor calls SetLogOutput before the
+// service is started with a writer that captures the logs in the service's
+// own rotated log file, <root>/<service>/service.log.
+type LogOutputSetter interface {
+	SetLogOutput(io.Writer)
+}
+
+// PortAssigner is an optional interface for services that listen on ports.
+// The Conductor calls AssignPorts before the service is set up or started
+// and the service should take every port it listens on from the allocator
+// instead of using fixed ports. The endpoints returned by Start should
+// contain the ports that were actually bound.
+type PortAssigner interface {
+	AssignPorts(ports *PortAllocator) error
+}
+
+// ConfigReloader is an optional interface for services whose configuration
+// is stored in their directory. When a restart asks for configuration to be
+// reloaded, the Conductor calls ReloadConfig while the service is stopped so
+// that changes made to the files take effect when it is started again.
+type ConfigReloader interface {
+	ReloadConfig(dir string) error
+}
+
+// Funder is an optional interface for services that control a funded
+// account on the chain, such as the validator of the consensus node. A
+// service that is added to an existing network can't have its accounts
+// funded in the genesis anymore, so the Conductor asks a running Funder to
+// send them the same balances before the service is first started.
+type Funder interface {
+	Fund(ctx context.Context, balances []banktypes.Balance) error
+}
+
+// Endpoints maps the names of endpoints to their addresses.
+type Endpoints map[string]Endpoint
+
+func (e Endpoints) copy() Endpoints {
+	cp := make(Endpoints, len(e))
+	for name, endpoint := range e {
+		cp[name] = endpoint
+	}
+	return cp
+}
 
 func (e Endpoints) String() string {
 	var output string
@@ -0,0 +1,546 @@
+package apollo
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	banktypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/tendermint/tendermint/types"
+)
+
+const (
+	// SnapshotsDir is the directory within the Apollo directory that
+	// snapshots are saved to. It is not part of the snapshots themselves.
+	SnapshotsDir = "snapshots"
+	// ConfigDir is the directory within the Apollo directory that holds
+	// the genesis of the network.
+	ConfigDir = "config"
+
+	snapshotExt      = ".tar.gz"
+	manifestName     = "manifest.json"
+	snapshotDataPath = "data"
+)
+
+var snapshotName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// SnapshotManifest describes the state of a network that was saved in a
+// snapshot.
+type SnapshotManifest struct {
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	ChainID string    `json:"chain_id"`
+	// Services are the services that have a directory in the snapshot.
+	Services []string `json:"services"`
+}
+
+// SnapshotPath returns the path of the archive of a snapshot.
+func SnapshotPath(root, name string) string {
+	return filepath.Join(root, SnapshotsDir, name+snapshotExt)
+}
+
+// SaveSnapshot archives the Apollo directory at root, apart from its
+// snapshots, into the snapshot with the given name. No services may be
+// running on the directory while it is archived. Use Conductor.SaveSnapshot
+// to save a running network.
+func SaveSnapshot(root, name string) (*SnapshotManifest, error) {
+	if err := checkNewSnapshot(root, name); err != nil {
+		return nil, err
+	}
+	archivePath := SnapshotPath(root, name)
+	doc, err := types.GenesisDocFromFile(filepath.Join(root, ConfigDir, "genesis.json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading genesis of the network: %w", err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &SnapshotManifest{
+		Name:     name,
+		Created:  time.Now().UTC(),
+		ChainID:  doc.ChainID,
+		Services: []string{},
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !isReservedDir(entry.Name()) {
+			manifest.Services = append(manifest.Services, entry.Name())
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(root, SnapshotsDir), os.ModePerm); err != nil {
+		return nil, err
+	}
+	// the archive is written to a temporary file first so that a failed
+	// save never leaves a partial snapshot behind
+	tmp, err := os.CreateTemp(filepath.Join(root, SnapshotsDir), "."+name+"-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := writeSnapshot(tmp, root, manifest); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("writing snapshot %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), archivePath); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func writeSnapshot(w io.Writer, root string, manifest *SnapshotManifest) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    manifestName,
+		Mode:    0o644,
+		Size:    int64(len(data)),
+		ModTime: manifest.Created,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if !strings.Contains(rel, string(filepath.Separator)) && !isSnapshotted(rel, entry.IsDir()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return addToSnapshot(tw, file, path.Join(snapshotDataPath, filepath.ToSlash(rel)))
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// addToSnapshot adds a file, directory or symlink to the archive. Other
+// kinds of files, such as sockets, are skipped.
+func addToSnapshot(tw *tar.Writer, file, name string) error {
+	info, err := os.Lstat(file)
+	if err != nil {
+		return err
+	}
+	var link string
+	switch mode := info.Mode(); {
+	case mode.IsRegular(), mode.IsDir():
+	case mode&os.ModeSymlink != 0:
+		if link, err = os.Readlink(file); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// logs may still be appended to while the file is copied, so only
+	// the size recorded in the header is archived
+	_, err = io.CopyN(tw, f, header.Size)
+	return err
+}
+
+// RestoreSnapshot replaces the contents of the Apollo directory at root
+// with those of a snapshot. The snapshots themselves are kept. The contents
+// are swapped with renames after the snapshot has been extracted, so the
+// directory either holds its previous state or that of the snapshot. No
+// services may be running on the directory while it is restored. Use
+// Conductor.RestoreSnapshot to restore the snapshot of a running network.
+func RestoreSnapshot(root, name string) (*SnapshotManifest, error) {
+	if !snapshotName.MatchString(name) {
+		return nil, fmt.Errorf("invalid snapshot name %q", name)
+	}
+	f, err := os.Open(SnapshotPath(root, name))
+	if err != nil {
+		return nil, fmt.Errorf("opening snapshot %s: %w", name, err)
+	}
+	defer f.Close()
+
+	snapshotsDir := filepath.Join(root, SnapshotsDir)
+	extracted, err := os.MkdirTemp(snapshotsDir, ".restore-"+name+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(extracted)
+	manifest, err := readSnapshot(f, extracted)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot %s: %w", name, err)
+	}
+
+	previous, err := os.MkdirTemp(snapshotsDir, ".previous-")
+	if err != nil {
+		return nil, err
+	}
+	if err := moveEntries(root, previous, isSnapshottedEntry); err != nil {
+		return nil, errors.Join(err, os.Remove(previous))
+	}
+	data := filepath.Join(extracted, snapshotDataPath)
+	if err := moveEntries(data, root, nil); err != nil {
+		// put the previous state back. If that fails too, it is left in
+		// the previous directory.
+		if undoErr := errors.Join(moveEntries(root, data, isSnapshottedEntry), moveEntries(previous, root, nil)); undoErr != nil {
+			return nil, fmt.Errorf("%w. The previous state could not be put back and is kept in %s: %w", err, previous, undoErr)
+		}
+		return nil, errors.Join(err, os.Remove(previous))
+	}
+	return manifest, os.RemoveAll(previous)
+}
+
+// readSnapshot extracts a snapshot into dir and returns its manifest.
+func readSnapshot(r io.Reader, dir string) (*SnapshotManifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var manifest *SnapshotManifest
+	if err := os.Mkdir(filepath.Join(dir, snapshotDataPath), os.ModePerm); err != nil {
+		return nil, err
+	}
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Name == manifestName {
+			manifest = &SnapshotManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			continue
+		}
+		if !filepath.IsLocal(header.Name) || !strings.HasPrefix(header.Name, snapshotDataPath+"/") {
+			return nil, fmt.Errorf("invalid path %s in snapshot", header.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if err := checkNoSymlinks(dir, filepath.FromSlash(header.Name)); err != nil {
+			return nil, err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, header.FileInfo().Mode().Perm()|0o700); err != nil {
+				return nil, err
+			}
+		case tar.TypeSymlink:
+			// links may only point to other entries of the snapshot
+			link := filepath.FromSlash(header.Linkname)
+			resolved, err := filepath.Rel(filepath.Join(dir, snapshotDataPath), filepath.Join(filepath.Dir(target), link))
+			if filepath.IsAbs(link) || err != nil || !filepath.IsLocal(resolved) {
+				return nil, fmt.Errorf("invalid link %s -> %s in snapshot", header.Name, header.Linkname)
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			if err := extractFile(tr, target, header.FileInfo().Mode().Perm()); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if manifest == nil {
+		return nil, errors.New("snapshot has no manifest")
+	}
+	return manifest, nil
+}
+
+// checkNoSymlinks returns an error if any existing element of the path name
+// within dir is a symlink, so that entries can't be extracted through links
+// that point elsewhere.
+func checkNoSymlinks(dir, name string) error {
+	current := dir
+	for _, element := range strings.Split(name, string(filepath.Separator)) {
+		current = filepath.Join(current, element)
+		info, err := os.Lstat(current)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("invalid path %s in snapshot: %s is a link", name, element)
+		}
+	}
+	return nil
+}
+
+func extractFile(r io.Reader, target string, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// moveEntries moves the entries of one directory into another. If include
+// is set, only the entries it returns true for are moved. If a move fails,
+// the entries that were already moved are moved back.
+func moveEntries(from, to string, include func(fs.DirEntry) bool) error {
+	entries, err := os.ReadDir(from)
+	if err != nil {
+		return err
+	}
+	moved := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if include != nil && !include(entry) {
+			continue
+		}
+		if err := os.Rename(filepath.Join(from, entry.Name()), filepath.Join(to, entry.Name())); err != nil {
+			for _, name := range moved {
+				if undoErr := os.Rename(filepath.Join(to, name), filepath.Join(from, name)); undoErr != nil {
+					err = errors.Join(err, undoErr)
+				}
+			}
+			return err
+		}
+		moved = append(moved, entry.Name())
+	}
+	return nil
+}
+
+// ListSnapshots returns the manifests of the snapshots of the Apollo
+// directory at root, sorted by name.
+func ListSnapshots(root string) ([]SnapshotManifest, error) {
+	entries, err := os.ReadDir(filepath.Join(root, SnapshotsDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	manifests := make([]SnapshotManifest, 0, len(entries))
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), snapshotExt)
+		if !ok || !snapshotName.MatchString(name) {
+			continue
+		}
+		manifest, err := readManifest(SnapshotPath(root, name))
+		if err != nil {
+			return nil, fmt.Errorf("reading snapshot %s: %w", name, err)
+		}
+		manifests = append(manifests, *manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Name < manifests[j].Name })
+	return manifests, nil
+}
+
+// readManifest reads the manifest, which is the first entry of a snapshot.
+func readManifest(archivePath string) (*SnapshotManifest, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if header.Name != manifestName {
+		return nil, errors.New("snapshot has no manifest")
+	}
+	var manifest SnapshotManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// checkNewSnapshot returns an error if a snapshot can't be saved under the
+// name.
+func checkNewSnapshot(root, name string) error {
+	if !snapshotName.MatchString(name) {
+		return fmt.Errorf("invalid snapshot name %q: only letters, digits, '.', '_' and '-' are allowed", name)
+	}
+	archivePath := SnapshotPath(root, name)
+	if _, err := os.Stat(archivePath); err == nil {
+		return fmt.Errorf("snapshot %s already exists at %s", name, archivePath)
+	}
+	return nil
+}
+
+// isReservedDir returns true for the directories of the Apollo directory
+// that can't be used by services.
+func isReservedDir(name string) bool {
+	return name == ConfigDir || name == SnapshotsDir
+}
+
+// isSnapshotted returns true for the entries of the Apollo directory that
+// are part of a snapshot. Snapshots and the files describing the current
+// run are left out.
+func isSnapshotted(name string, isDir bool) bool {
+	if isDir {
+		return name != SnapshotsDir
+	}
+	return !slices.Contains([]string{PanelAddressFile, StartupReportFile, LockFile}, name)
+}
+
+func isSnapshottedEntry(entry fs.DirEntry) bool {
+	return isSnapshotted(entry.Name(), entry.IsDir())
+}
+
+// SaveSnapshot saves the state of the network in a snapshot. Running
+// services are stopped while the Apollo directory is archived and started
+// again afterwards.
+func (c *Conductor) SaveSnapshot(ctx context.Context, name string) (*SnapshotManifest, error) {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+
+	// the network is only stopped for snapshots that can be saved
+	if err := checkNewSnapshot(c.rootDir, name); err != nil {
+		return nil, err
+	}
+	running := c.runningServices()
+	if err := c.stopSelected(ctx, running); err != nil {
+		return nil, err
+	}
+	c.logger.Printf("saving snapshot %s", name)
+	manifest, err := SaveSnapshot(c.rootDir, name)
+	if err != nil {
+		return nil, errors.Join(err, c.startSelected(ctx, running))
+	}
+	c.logger.Printf("saved snapshot %s to %s", name, SnapshotPath(c.rootDir, name))
+	return manifest, c.startSelected(ctx, running)
+}
+
+// RestoreSnapshot replaces the state of the network with that of a
+// snapshot. Running services are stopped before the Apollo directory is
+// restored and started again afterwards from the snapshot's state. Services
+// that implement ConfigReloader re-read their configuration, and services
+// that aren't part of the snapshot are set up as if they were added to an
+// existing network.
+func (c *Conductor) RestoreSnapshot(ctx context.Context, name string) (*SnapshotManifest, error) {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+
+	running := c.runningServices()
+	if err := c.stopSelected(ctx, running); err != nil {
+		return nil, err
+	}
+	c.logger.Printf("restoring snapshot %s", name)
+	c.closeLogs()
+	manifest, err := RestoreSnapshot(c.rootDir, name)
+	if err != nil {
+		// the previous state was kept so the network can be started again
+		return nil, errors.Join(err, c.openLogs(), c.startSelected(ctx, running))
+	}
+	if err := c.loadSnapshotState(ctx); err != nil {
+		return nil, errors.Join(err, c.openLogs(), c.startSelected(ctx, running))
+	}
+	c.logger.Printf("restored snapshot %s", name)
+	return manifest, c.startSelected(ctx, running)
+}
+
+// loadSnapshotState loads the genesis, conductor state, configuration and
+// pending funding of services from a restored Apollo directory. The caller
+// must hold the operation lock.
+func (c *Conductor) loadSnapshotState(ctx context.Context) error {
+	doc, err := types.GenesisDocFromFile(filepath.Join(c.rootDir, ConfigDir, "genesis.json"))
+	if err != nil {
+		return err
+	}
+	c.genesisDoc = doc
+	c.created = nil
+	c.funding = make(map[string][]banktypes.Balance)
+
+	existing := make(map[string]bool, len(c.services))
+	for name := range c.services {
+		if _, err := os.Stat(filepath.Join(c.rootDir, name)); errors.Is(err, os.ErrNotExist) {
+			if err := c.setupNewService(ctx, name); err != nil {
+				return err
+			}
+			continue
+		}
+		existing[name] = true
+		if err := c.loadFunding(name); err != nil {
+			return err
+		}
+	}
+	if err := c.openLogs(); err != nil {
+		return err
+	}
+	if err := c.loadState(); err != nil {
+		return err
+	}
+	return c.reloadConfig(existing)
+}
+
+// runningServices returns the services that are running or waiting to be
+// restarted after a crash.
+func (c *Conductor) runningServices() map[string]bool {
+	running := make(map[string]bool)
+	for name := range c.services {
+		if c.isStoppable(name) {
+			running[name] = true
+		}
+	}
+	return running
+}
@@ -0,0 +1,147 @@
+package apollo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// StateFile is the name of the file within the config directory that the
+// desired state of the network is persisted to.
+const StateFile = "conductor.json"
+
+// ConductorState is the desired state of a network. It is kept up to date
+// in <root>/config/conductor.json so that a network is brought back to the
+// same state when it is run again.
+type ConductorState struct {
+	Services map[string]ServiceState `json:"services"`
+	// StartOrder is the order in which the enabled services were last
+	// started.
+	StartOrder []string `json:"start_order"`
+}
+
+// ServiceState is the desired state of a single service.
+type ServiceState struct {
+	// Enabled is false for services that were stopped individually. They
+	// are not started when the network is resumed.
+	Enabled bool `json:"enabled"`
+	// Endpoints are the endpoints the service provided when it was last
+	// started.
+	Endpoints Endpoints `json:"endpoints,omitempty"`
+}
+
+// ReadState reads the desired state of the network in the Apollo directory
+// at root.
+func ReadState(root string) (*ConductorState, error) {
+	data, err := os.ReadFile(filepath.Join(root, ConfigDir, StateFile))
+	if err != nil {
+		return nil, err
+	}
+	var state ConductorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid conductor state: %w", err)
+	}
+	return &state, nil
+}
+
+// loadState loads the persisted state of the network. Services that aren't
+// part of it are enabled. The caller must hold the operation lock.
+func (c *Conductor) loadState() error {
+	state, err := ReadState(c.rootDir)
+	if errors.Is(err, os.ErrNotExist) {
+		state = &ConductorState{}
+	} else if err != nil {
+		return err
+	}
+	if state.Services == nil {
+		state.Services = make(map[string]ServiceState)
+	}
+	for name := range c.services {
+		if _, ok := state.Services[name]; !ok {
+			state.Services[name] = ServiceState{Enabled: true}
+		}
+	}
+	c.state = state
+	return nil
+}
+
+// saveState persists the state of the network. Failures are only logged
+// as they don't affect the running network. The caller must hold the
+// operation lock.
+func (c *Conductor) saveState() {
+	if c.state == nil {
+		return
+	}
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		c.logger.Printf("failed to encode conductor state: %s", err.Error())
+		return
+	}
+	path := filepath.Join(c.rootDir, ConfigDir, StateFile)
+	// write to a temporary file first so that the state is never truncated
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		c.logger.Printf("failed to save conductor state: %s", err.Error())
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		c.logger.Printf("failed to save conductor state: %s", err.Error())
+	}
+}
+
+// setEnabled records whether services should run when the network is
+// resumed. The caller must hold the operation lock.
+func (c *Conductor) setEnabled(enabled bool, names ...string) {
+	if c.state == nil {
+		return
+	}
+	for _, name := range names {
+		service := c.state.Services[name]
+		service.Enabled = enabled
+		c.state.Services[name] = service
+		if !enabled {
+			c.state.StartOrder = slices.DeleteFunc(c.state.StartOrder, func(started string) bool {
+				return started == name
+			})
+		}
+	}
+}
+
+// recordStarted records the endpoints of a service that has started and
+// marks it enabled. The caller must hold the operation lock.
+func (c *Conductor) recordStarted(name string, endpoints Endpoints) {
+	if c.state == nil {
+		return
+	}
+	c.state.Services[name] = ServiceState{Enabled: true, Endpoints: endpoints}
+	c.state.StartOrder = slices.DeleteFunc(c.state.StartOrder, func(started string) bool {
+		return started == name
+	})
+	c.state.StartOrder = append(c.state.StartOrder, name)
+}
+
+// Resume starts the services that were running when the network was last
+// run, together with the services they depend on. Services that were
+// stopped individually stay stopped. On a new network, all services are
+// started.
+func (c *Conductor) Resume(ctx context.Context) error {
+	c.opLock.Lock()
+	defer c.opLock.Unlock()
+
+	if c.state == nil {
+		return fmt.Errorf("Conductor has not setup all services. Call `Setup` first")
+	}
+	selected := make(map[string]bool)
+	for name := range c.services {
+		if c.state.Services[name].Enabled {
+			for dependency := range closure(name, c.deps) {
+				selected[dependency] = true
+			}
+		}
+	}
+	return c.startSelected(ctx, selected)
+}
@@ -0,0 +1,242 @@
+package apollo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RestartPolicy configures how the Conductor recovers services that have
+// crashed after they were started.
+type RestartPolicy struct {
+	// MaxRestarts is the maximum number of times a service is
+	// automatically restarted before the Conductor gives up on it. The
+	// count is reset whenever the service is started manually. Zero
+	// disables automatic restarts.
+	MaxRestarts int
+	// InitialBackoff is the time waited before the first restart attempt.
+	// It doubles after every failed attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the time waited between restart attempts.
+	MaxBackoff time.Duration
+	// FailureThreshold is the number of consecutive failed health checks
+	// after which a service is considered to have crashed.
+	FailureThreshold int
+}
+
+// DefaultRestartPolicy returns the restart policy used by the Conductor
+// unless another is provided.
+func DefaultRestartPolicy() RestartPolicy {
+	return RestartPolicy{
+		MaxRestarts:      5,
+		InitialBackoff:   time.Second,
+		MaxBackoff:       30 * time.Second,
+		FailureThreshold: 3,
+	}
+}
+
+// supervision tracks crashes and automatic restarts of a service.
+type supervision struct {
+	restarts   int
+	lastError  string
+	recovering bool
+	failed     bool
+}
+
+// WithRestartPolicy sets the policy used to restart crashed services.
+func (c *Conductor) WithRestartPolicy(policy RestartPolicy) *Conductor {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.restartPolicy = policy
+	return c
+}
+
+func (c *Conductor) supervision(name string) *supervision {
+	record, ok := c.supervisions[name]
+	if !ok {
+		record = &supervision{}
+		c.supervisions[name] = record
+	}
+	return record
+}
+
+// resetSupervision resets the restart count of a service. This is done
+// whenever a service is started manually.
+func (c *Conductor) resetSupervision(name string) {
+	if record, ok := c.supervisions[name]; ok {
+		record.restarts = 0
+		record.failed = false
+	}
+}
+
+// markFailed records that a service failed to start. Failed restarts of
+// crashed services are left to their supervisor. The caller must hold the
+// state lock.
+func (c *Conductor) markFailed(name string, err error) {
+	record := c.supervision(name)
+	record.lastError = err.Error()
+	if !record.recovering {
+		record.failed = true
+	}
+}
+
+// supervise starts a goroutine that watches a running service for crashes,
+// either by probing its health or by listening for failures if the service
+// implements FailureNotifier. Any previous supervisor of the service is
+// cancelled.
+func (c *Conductor) supervise(name string) {
+	if cancel, ok := c.monitors[name]; ok {
+		cancel()
+	}
+	if record, ok := c.supervisions[name]; ok {
+		record.recovering = false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.monitors[name] = cancel
+
+	service := c.services[name]
+	var failed <-chan error
+	if notifier, ok := service.(FailureNotifier); ok {
+		failed = notifier.Failed()
+	}
+	checker, _ := service.(HealthChecker)
+
+	go func() {
+		if cause := c.watch(ctx, name, checker, failed); cause != nil {
+			c.recover(ctx, name, cause)
+		}
+	}()
+}
+
+// stopSupervising cancels the supervisor of the service, including any
+// ongoing attempt to recover it, and clears its health records.
+func (c *Conductor) stopSupervising(name string) {
+	if cancel, ok := c.monitors[name]; ok {
+		cancel()
+		delete(c.monitors, name)
+	}
+	if record, ok := c.supervisions[name]; ok {
+		record.recovering = false
+	}
+	c.clearHealth(name)
+}
+
+// watch blocks until the service has crashed, returning the cause, or
+// until the context is cancelled, in which case nil is returned.
+func (c *Conductor) watch(ctx context.Context, name string, checker HealthChecker, failed <-chan error) error {
+	var tick <-chan time.Time
+	if checker != nil {
+		ticker := time.NewTicker(livenessInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-failed:
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err == nil {
+				return fmt.Errorf("service %s exited unexpectedly", name)
+			}
+			return fmt.Errorf("service %s failed: %w", name, err)
+		case <-tick:
+			err := c.checkHealth(ctx, name, checker)
+			if err == nil || ctx.Err() != nil {
+				continue
+			}
+			c.logger.Printf("health check for service %s failed: %s", name, err.Error())
+			c.lock.Lock()
+			threshold := c.restartPolicy.FailureThreshold
+			c.lock.Unlock()
+			if failures := c.consecutiveFailures(name); failures >= threshold {
+				return fmt.Errorf("service %s failed %d consecutive health checks: %w", name, failures, err)
+			}
+		}
+	}
+}
+
+// recover marks a crashed service as inactive and then attempts to restart
+// it according to the restart policy. Restarting is abandoned if the
+// service is started or stopped by other means in the meantime. Like any
+// other operation, each step holds the operation lock so that it can't
+// interleave with services being started or stopped through the API.
+func (c *Conductor) recover(ctx context.Context, name string, cause error) {
+	c.opLock.Lock()
+	c.lock.Lock()
+	if ctx.Err() != nil {
+		c.lock.Unlock()
+		c.opLock.Unlock()
+		return
+	}
+	c.logger.Printf("service %s crashed: %s", name, cause.Error())
+	record := c.supervision(name)
+	record.lastError = cause.Error()
+	record.recovering = true
+	policy := c.restartPolicy
+	timeout := c.timeoutsOf(name).Stop
+	c.lock.Unlock()
+
+	// make sure any remaining parts of the service are shut down before
+	// removing it and its endpoints from the active set
+	service := c.services[name]
+	if err := withTimeout(ctx, timeout, "stop", service.Stop); err != nil {
+		c.logger.Printf("failed to stop crashed service %s: %s", name, err.Error())
+	}
+	c.lock.Lock()
+	c.deactivate(name)
+	for _, endpoint := range service.EndpointsProvided() {
+		delete(c.activeEndpoints, endpoint)
+	}
+	c.emit(EventServiceFailed, name, nil, cause)
+	c.emitEndpointsChanged()
+	c.lock.Unlock()
+	c.opLock.Unlock()
+
+	backoff := policy.InitialBackoff
+	for {
+		c.lock.Lock()
+		if record.restarts >= policy.MaxRestarts {
+			record.recovering = false
+			record.failed = true
+			c.logger.Printf("service %s has been restarted %d times, giving up", name, record.restarts)
+			c.lock.Unlock()
+			return
+		}
+		c.lock.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		c.opLock.Lock()
+		c.lock.Lock()
+		if ctx.Err() != nil {
+			c.lock.Unlock()
+			c.opLock.Unlock()
+			return
+		}
+		record.restarts++
+		c.logger.Printf("restarting service %s (attempt %d of %d)", name, record.restarts, policy.MaxRestarts)
+		c.lock.Unlock()
+		// On success, a new supervisor takes over and this one is cancelled.
+		err := c.startServices(context.Background(), []string{name})
+		c.opLock.Unlock()
+		if err == nil {
+			return
+		}
+		c.lock.Lock()
+		record.lastError = err.Error()
+		c.lock.Unlock()
+		c.logger.Printf("failed to restart service %s: %s", name, err.Error())
+
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package apollo
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultSetupTimeout is how long a service is given to set up.
+	DefaultSetupTimeout = 2 * time.Minute
+	// DefaultStartTimeout is how long a service is given to start and
+	// become ready.
+	DefaultStartTimeout = 5 * time.Minute
+	// DefaultStopTimeout is how long a service is given to stop before the
+	// Conductor gives up on it.
+	DefaultStopTimeout = 30 * time.Second
+
+	// abandonGracePeriod is how long a function is waited for after it
+	// has timed out.
+	abandonGracePeriod = 500 * time.Millisecond
+)
+
+// Timeouts limit how long the Conductor waits for a service to set up,
+// start and stop. A service that doesn't finish in time fails with an error
+// saying which step timed out. A zero timeout means no limit.
+type Timeouts struct {
+	Setup time.Duration `json:"setup"`
+	// Start includes the time it takes a HealthChecker to become ready.
+	Start time.Duration `json:"start"`
+	Stop  time.Duration `json:"stop"`
+}
+
+// DefaultTimeouts returns the timeouts that apply to every service unless
+// they are changed.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Setup: DefaultSetupTimeout,
+		Start: DefaultStartTimeout,
+		Stop:  DefaultStopTimeout,
+	}
+}
+
+// WithTimeouts sets the timeouts of all services that don't have their own.
+func (c *Conductor) WithTimeouts(timeouts Timeouts) *Conductor {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.timeouts = timeouts
+	return c
+}
+
+// WithServiceTimeouts sets the timeouts of a single service. Timeouts that
+// are zero are taken from those of all services.
+func (c *Conductor) WithServiceTimeouts(name string, timeouts Timeouts) *Conductor {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.serviceTimeouts[name] = timeouts
+	return c
+}
+
+// timeoutsOf returns the timeouts of a service. The caller must hold the
+// state lock.
+func (c *Conductor) timeoutsOf(name string) Timeouts {
+	timeouts := c.timeouts
+	override := c.serviceTimeouts[name]
+	if override.Setup != 0 {
+		timeouts.Setup = override.Setup
+	}
+	if override.Start != 0 {
+		timeouts.Start = override.Start
+	}
+	if override.Stop != 0 {
+		timeouts.Stop = override.Stop
+	}
+	return timeouts
+}
+
+// withTimeout calls fn with a context that is cancelled after the timeout
+// and returns once fn has returned or the timeout has passed, whichever is
+// first. Services may not respect the context, so fn is left running in the
+// background if it doesn't return in time.
+func withTimeout(ctx context.Context, timeout time.Duration, op string, fn func(context.Context) error) error {
+	_, err := callWithTimeout(ctx, timeout, op, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	}, nil)
+	return err
+}
+
+// callWithTimeout is like withTimeout for functions that return a value.
+// If fn succeeds after the timeout has passed, its result is passed to
+// abandon so that it can be cleaned up.
+func callWithTimeout[T any](ctx context.Context, timeout time.Duration, op string, fn func(context.Context) (T, error), abandon func(T)) (T, error) {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%s timed out after %s", op, timeout))
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := fn(ctx)
+		done <- result{value, err}
+	}()
+	finish := func(r result) (T, error) {
+		if r.err != nil && ctx.Err() != nil {
+			// fn gave up because of the timeout
+			return r.value, fmt.Errorf("%w: %w", context.Cause(ctx), r.err)
+		}
+		return r.value, r.err
+	}
+	select {
+	case r := <-done:
+		return finish(r)
+	case <-ctx.Done():
+		// functions that respect the context usually return an error that
+		// says what they were waiting for, so they are given a moment to
+		// return it
+		select {
+		case r := <-done:
+			return finish(r)
+		case <-time.After(abandonGracePeriod):
+		}
+		go func() {
+			if r := <-done; r.err == nil && abandon != nil {
+				abandon(r.value)
+			}
+		}()
+		var zero T
+		return zero, context.Cause(ctx)
+	}
+}
@@ -1,6 +1,23 @@
 
 
 load()
+listen()
+
+// listen reloads the panel whenever the conductor reports a lifecycle
+// event. The browser automatically reconnects if the stream drops.
+function listen() {
+    const events = new EventSource('/events');
+    const types = ['starting', 'started', 'stopping', 'stopped', 'failed', 'health_changed', 'endpoints_changed'];
+    for (const type of types) {
+        events.addEventListener(type, event => {
+            const data = JSON.parse(event.data);
+            if (type === 'failed' && data.error) {
+                createPopup(`Service ${data.service} failed: ${data.error}`);
+            }
+            load();
+        });
+    }
+}
 
 function load() {
     fetch('/status')
@@ -14,6 +31,7 @@ function load() {
 
 function renderStatusData(data) {
     console.log(data)
+    renderLogServices(Object.keys(data));
     
     const controlPanel = document.getElementById('control-panel');
     controlPanel.innerHTML = '';
@@ -50,6 +68,17 @@ function renderStatusData(data) {
                 stopService(serviceName);
             }
             controlButtonsDiv.appendChild(stopButton);
+
+            const restartButton = document.createElement('button');
+            restartButton.textContent = 'Restart';
+            restartButton.className = 'restart-button';
+            restartButton.onclick = () => {
+                restartButton.style.color = 'white';
+                restartButton.style.borderColor = 'white'
+                restartButton.textContent = 'Restarting...'
+                restartService(serviceName);
+            }
+            controlButtonsDiv.appendChild(restartButton);
         }
 
         // Append control buttons div to card div
@@ -59,6 +88,22 @@ function renderStatusData(data) {
         serviceNameDiv.className = 'title';
         serviceNameDiv.textContent = convertKebabCase(serviceName);
         cardDiv.appendChild(serviceNameDiv);
+        if (info.running && info.health) {
+            cardDiv.appendChild(renderHealth(info.health));
+        }
+        if (info.recovering || info.failed || info.restarts > 0) {
+            const supervisionDiv = document.createElement('div');
+            supervisionDiv.className = 'subtitle';
+            if (info.recovering) {
+                supervisionDiv.textContent = `Crashed, restarting... (${info.restarts} restarts)`;
+            } else if (info.failed) {
+                supervisionDiv.textContent = `Crashed and could not be restarted after ${info.restarts} attempts`;
+            } else {
+                supervisionDiv.textContent = `Restarted ${info.restarts} times`;
+            }
+            supervisionDiv.title = info.last_error || '';
+            cardDiv.appendChild(supervisionDiv);
+        }
         if (info.running) {
             const endpointsTitleDiv = document.createElement('div');
             endpointsTitleDiv.className = 'subtitle';
@@ -74,6 +119,23 @@ function renderStatusData(data) {
     }
 }
 
+function renderHealth(health) {
+    const healthDiv = document.createElement('div');
+    healthDiv.className = 'health';
+    healthDiv.title = health.healthy ? `Last checked ${health.last_checked}` : health.error;
+    for (const check of health.history) {
+        const dot = document.createElement('span');
+        dot.className = check.healthy ? 'health-dot healthy' : 'health-dot unhealthy';
+        dot.title = check.time;
+        healthDiv.appendChild(dot);
+    }
+    const label = document.createElement('span');
+    label.className = 'subtitle';
+    label.textContent = health.healthy ? ' healthy' : ` unhealthy: ${health.error}`;
+    healthDiv.appendChild(label);
+    return healthDiv;
+}
+
 function clickEndpoint(endpoint) {
     if (/^(http:\/\/|https:\/\/).*/.test(endpoint)) {
         window.open(endpoint, '_blank').focus();
@@ -98,17 +160,18 @@ function convertKebabCase(str) {
 
 var popup
 
+// starting a service also starts any services it depends on
 function startService(name) {
-    fetch(`/start/${name}`)
+    fetch(`/start/${name}?cascade=true`)
     .then(response => {
         if (response.status != 200) {
             response.text().then(body => {
                 createPopup(`Error starting service ${name}: ${body}`);
             });
+            load()
         } else {
             console.log('Sucessfully started ' + name)
         }
-        load()
     })
     .catch(error => {
         console.error('Error starting service:', error);
@@ -116,17 +179,24 @@ function startService(name) {
     });
 }
 
-function stopService(name) {
-    fetch(`/stop/${name}`)
+// stopping a service that others depend on asks whether to stop them too
+function stopService(name, cascade = false) {
+    fetch(`/stop/${name}` + (cascade ? '?cascade=true' : ''))
     .then(response => {
         if (response.status != 200) {
             response.text().then(body => {
+                if (!cascade && body.includes('provides required endpoint')) {
+                    if (confirm(`Other services depend on ${name}. Stop them as well?`)) {
+                        stopService(name, true);
+                        return;
+                    }
+                }
                 createPopup(`Error stopping service ${name}: ${body}`);
             });
+            load()
         } else {
             console.log('Sucessfully stopped ' + name)
         }
-        load()
     })
     .catch(error => {
         console.error('Error stopping service:', error);
@@ -134,6 +204,117 @@ function stopService(name) {
     });
 }
 
+// restarting a service also restarts the services that depend on it
+function restartService(name) {
+    fetch(`/restart/${name}`)
+    .then(response => {
+        if (response.status != 200) {
+            response.text().then(body => {
+                createPopup(`Error restarting service ${name}: ${body}`);
+            });
+            load()
+        } else {
+            console.log('Sucessfully restarted ' + name)
+        }
+    })
+    .catch(error => {
+        console.error('Error restarting service:', error);
+        createPopup(`Error restarting service ${name}: ${error}`);
+    });
+}
+
+function restartNetwork() {
+    fetch('/restart-all/')
+    .then(response => {
+        if (response.status != 200) {
+            response.text().then(body => {
+                createPopup(`Error restarting network: ${body}`);
+            });
+            load()
+        } else {
+            console.log('Sucessfully restarted network')
+        }
+    })
+    .catch(error => {
+        console.error('Error restarting network:', error);
+        createPopup(`Error restarting network: ${error}`);
+    });
+}
+
+function showTab(name) {
+    for (const tab of ['services', 'logs']) {
+        document.getElementById(`${tab}-view`).style.display = tab === name ? '' : 'none';
+        document.getElementById(`${tab}-tab`).classList.toggle('active', tab === name);
+    }
+    const select = document.getElementById('log-service');
+    if (name === 'logs' && select.value) {
+        followLogs(select.value);
+    } else if (name !== 'logs') {
+        stopFollowingLogs();
+    }
+}
+
+function renderLogServices(names) {
+    const select = document.getElementById('log-service');
+    const current = select.value;
+    select.innerHTML = '';
+    for (const name of names.sort()) {
+        const option = document.createElement('option');
+        option.value = name;
+        option.textContent = convertKebabCase(name);
+        select.appendChild(option);
+    }
+    if (current) {
+        select.value = current;
+    }
+}
+
+var logStream
+
+function stopFollowingLogs() {
+    if (logStream != null) {
+        logStream.abort();
+        logStream = null;
+    }
+}
+
+// followLogs shows the tail of a service's log and appends new output as it
+// is written.
+function followLogs(name) {
+    stopFollowingLogs();
+    const output = document.getElementById('log-output');
+    output.textContent = '';
+    const controller = new AbortController();
+    logStream = controller;
+    fetch(`/logs/${name}?tail=500&follow=true`, { signal: controller.signal })
+    .then(response => {
+        if (response.status != 200) {
+            response.text().then(body => createPopup(`Error fetching logs for ${name}: ${body}`));
+            return;
+        }
+        const reader = response.body.getReader();
+        const decoder = new TextDecoder();
+        const read = () => reader.read().then(({ done, value }) => {
+            if (done) {
+                return;
+            }
+            const atBottom = output.scrollTop + output.clientHeight >= output.scrollHeight - 5;
+            output.textContent += decoder.decode(value, { stream: true });
+            if (atBottom) {
+                output.scrollTop = output.scrollHeight;
+            }
+            read();
+        });
+        read();
+    })
+    .catch(error => {
+        if (error.name !== 'AbortError') {
+            console.error('Error fetching logs:', error);
+            createPopup(`Error fetching logs for ${name}: ${error}`);
+        }
+    });
+}
+
 function createPopup(text) {
     if (popup != null) {
         document.body.removeChild(popup);